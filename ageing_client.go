@@ -1,8 +1,13 @@
 package consumer
 
 import (
+	"context"
 	"errors"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"sync"
 	"time"
 
 	log "github.com/Financial-Times/go-logger/v2"
@@ -21,6 +26,7 @@ func NewAgeingClient(client *http.Client, maxAge time.Duration, logger *log.UPPL
 		HTTPClient: client,
 		MaxAge:     maxAge,
 		Logger:     logger,
+		state:      &ageingState{},
 	}, nil
 }
 
@@ -29,16 +35,247 @@ type AgeingClient struct {
 	HTTPClient *http.Client
 	MaxAge     time.Duration
 	Logger     *log.UPPLogger
+	//PerConnection closes every connection of the consumer older than MaxAge once a request using it completes,
+	//instead of periodically closing all idle connections. It requires the transport of HTTPClient to be an *http.Transport,
+	//other transports are aged periodically.
+	PerConnection bool
+
+	//shared by the copies of the client, so the methods can be called on values
+	state *ageingState
+}
+
+// ageingState is the ageing process of an AgeingClient
+type ageingState struct {
+	mu   sync.Mutex
+	done chan struct{}
+	//number of the started consumers and calls of StartAgeingProcess, the ageing process runs while it is positive
+	started int
+	//clients of the started consumers built on HTTPClient with their own transport
+	clients []*http.Client
 }
 
-//StartAgeingProcess periodically close idle connections according to the MaxAge of an AgeingClient
+// ageingStateMu guards the creation of the state of the clients not created by NewAgeingClient
+var ageingStateMu sync.Mutex
+
+//StartAgeingProcess periodically close idle connections according to the MaxAge of an AgeingClient, until StopAgeingProcess is called
+//as many times as it was started. The transport of HTTPClient, or one it wraps, has to implement CloseIdleConnections.
+//The process is shared by the copies of a client returned by NewAgeingClient. The process of a client built
+//as a literal cannot be stopped, it runs until the program exits.
 func (c AgeingClient) StartAgeingProcess() {
+	c.start(nil)
+}
+
+//StopAgeingProcess stops closing idle connections once every start has been stopped
+func (c AgeingClient) StopAgeingProcess() {
+	c.stop(nil)
+}
+
+// ageing returns the state of the ageing process, creating it for the clients built as literals
+func (c *AgeingClient) ageing() *ageingState {
+	ageingStateMu.Lock()
+	defer ageingStateMu.Unlock()
+	if c.state == nil {
+		c.state = &ageingState{}
+	}
+	return c.state
+}
+
+// start starts the ageing process for a consumer sending its requests with hc, if not already running
+func (c *AgeingClient) start(hc *http.Client) {
+	s := c.ageing()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started++
+	if hc != nil && hc != c.HTTPClient {
+		s.clients = append(s.clients, hc)
+	}
+	if s.done != nil || c.perConnection() {
+		return
+	}
+
 	c.Logger.Infof("Starting aging [%d]", c.MaxAge)
+	done := make(chan struct{})
+	s.done = done
 	ticker := time.NewTicker(c.MaxAge)
 	go func() {
-		for range ticker.C {
-			c.Logger.Info("Closing idle connections")
-			c.HTTPClient.Transport.(*http.Transport).CloseIdleConnections()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				c.Logger.Info("Closing idle connections")
+				c.closeIdleConnections()
+			}
 		}
 	}()
 }
+
+// stop drops hc from the aged clients and stops the ageing process once no consumer is started
+func (c *AgeingClient) stop(hc *http.Client) {
+	s := c.ageing()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, client := range s.clients {
+		if client == hc {
+			s.clients = append(s.clients[:i], s.clients[i+1:]...)
+			break
+		}
+	}
+	if s.started > 0 {
+		s.started--
+	}
+	if s.started == 0 && s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+}
+
+func (c *AgeingClient) closeIdleConnections() {
+	s := c.ageing()
+	s.mu.Lock()
+	transports := []http.RoundTripper{transportOf(c.HTTPClient)}
+	for _, client := range s.clients {
+		transports = append(transports, transportOf(client))
+	}
+	s.mu.Unlock()
+
+	for _, t := range transports {
+		if !closeIdleConnections(t) {
+			c.Logger.Warn("The transport does not support closing idle connections")
+		}
+	}
+}
+
+// perConnection reports whether the connections are aged one by one, which requires dialing them
+func (c *AgeingClient) perConnection() bool {
+	if !c.PerConnection {
+		return false
+	}
+	_, ok := transportOf(c.HTTPClient).(*http.Transport)
+	return ok
+}
+
+// dialer returns a copy of hc whose transport dials connections recording their age, when they are aged one by one
+func (c *AgeingClient) dialer(hc *http.Client) *http.Client {
+	if !c.perConnection() {
+		return hc
+	}
+	transport := transportOf(hc).(*http.Transport).Clone()
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &ageingConn{Conn: conn, created: time.Now()}, nil
+	}
+	aged := *hc
+	aged.Transport = transport
+	return &aged
+}
+
+// client returns the client the consumer sends its requests with, ageing the connections of hc.
+// hc is the client returned by dialer, or a copy of it with its own transport.
+func (c *AgeingClient) client(hc *http.Client) *http.Client {
+	if !c.perConnection() {
+		return hc
+	}
+	aged := *hc
+	aged.Transport = &ageingTransport{next: transportOf(hc), maxAge: c.MaxAge}
+	return &aged
+}
+
+// ageingTransport closes the connections older than maxAge when a request using them completes.
+// The connections are recognised through the httptrace hooks, so it works with any transport
+// wrapping the one dialing ageingConns.
+type ageingTransport struct {
+	next   http.RoundTripper
+	maxAge time.Duration
+}
+
+func (t *ageingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var expired *ageingConn
+	trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) {
+		if conn := agedConn(info.Conn); conn != nil && time.Since(conn.created) >= t.maxAge {
+			expired = conn
+		}
+	}}
+	resp, err := t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil || expired == nil {
+		return resp, err
+	}
+	// the transport drops the connection from its pool once it is closed
+	resp.Body = &recyclingBody{ReadCloser: resp.Body, recycle: func() { expired.Close() }}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport
+func (t *ageingTransport) CloseIdleConnections() {
+	closeIdleConnections(t.next)
+}
+
+// Unwrap returns the wrapped transport
+func (t *ageingTransport) Unwrap() http.RoundTripper {
+	return t.next
+}
+
+// ageingConn is a connection dialed by an aged client, which knows its own age so nothing is kept once it is closed
+type ageingConn struct {
+	net.Conn
+	created time.Time
+}
+
+// agedConn returns the ageingConn the connection is, or wraps, like a TLS connection does
+func agedConn(conn net.Conn) *ageingConn {
+	for conn != nil {
+		switch c := conn.(type) {
+		case *ageingConn:
+			return c
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+type recyclingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	recycle func()
+}
+
+func (b *recyclingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.recycle)
+	return err
+}
+
+// closeIdleConnections closes the idle connections of the transport, or of the first transport it wraps which supports it.
+// It reports whether any did.
+func closeIdleConnections(rt http.RoundTripper) bool {
+	for rt != nil {
+		switch t := rt.(type) {
+		case interface{ CloseIdleConnections() }:
+			t.CloseIdleConnections()
+			return true
+		case interface{ Unwrap() http.RoundTripper }:
+			rt = t.Unwrap()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func transportOf(client *http.Client) http.RoundTripper {
+	if client.Transport == nil {
+		return http.DefaultTransport
+	}
+	return client.Transport
+}
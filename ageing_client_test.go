@@ -0,0 +1,226 @@
+package consumer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// counts the idle connection closures
+type closingTransport struct {
+	closes atomic.Int32
+}
+
+func (t *closingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, nil
+}
+
+func (t *closingTransport) CloseIdleConnections() {
+	t.closes.Add(1)
+}
+
+// wraps a transport without closing its idle connections itself, like instrumenting round-trippers
+type wrappingTransport struct {
+	next http.RoundTripper
+}
+
+func (t wrappingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(req)
+}
+
+func (t wrappingTransport) Unwrap() http.RoundTripper {
+	return t.next
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCloseIdleConnectionsThroughWrappedTransports(t *testing.T) {
+	inner := &closingTransport{}
+	assert.True(t, closeIdleConnections(wrappingTransport{wrappingTransport{inner}}))
+	assert.Equal(t, int32(1), inner.closes.Load())
+
+	assert.False(t, closeIdleConnections(roundTripperFunc(http.DefaultTransport.RoundTrip)))
+}
+
+func TestAgeingProcessStops(t *testing.T) {
+	inner := &closingTransport{}
+	client, err := NewAgeingClient(&http.Client{Transport: wrappingTransport{inner}}, 5*time.Millisecond, log.NewUPPLogger("Test", "FATAL"))
+	require.NoError(t, err)
+
+	client.StartAgeingProcess()
+	client.StartAgeingProcess()
+	waitFor(t, func() bool { return inner.closes.Load() >= 2 })
+
+	client.StopAgeingProcess()
+	closes := inner.closes.Load()
+	waitFor(t, func() bool { return inner.closes.Load() > closes })
+
+	client.StopAgeingProcess()
+	time.Sleep(10 * time.Millisecond)
+	closes = inner.closes.Load()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, closes, inner.closes.Load(), "no connections should be closed after the process stopped")
+}
+
+func TestAgeingClientClosesTransportsOfConsumers(t *testing.T) {
+	inner := &closingTransport{}
+	client, err := NewAgeingClient(&http.Client{}, time.Minute, log.NewUPPLogger("Test", "FATAL"))
+	require.NoError(t, err)
+
+	assert.Same(t, client.HTTPClient, client.client(client.HTTPClient))
+	consumerClient := &http.Client{Transport: inner}
+	client.start(consumerClient)
+	client.closeIdleConnections()
+	assert.Equal(t, int32(1), inner.closes.Load())
+
+	client.stop(consumerClient)
+	client.closeIdleConnections()
+	assert.Equal(t, int32(1), inner.closes.Load(), "the transports of stopped consumers should be dropped")
+	assert.Empty(t, client.state.clients)
+}
+
+func TestConsumerStopsAgeingProcess(t *testing.T) {
+	client, err := NewAgeingClient(&http.Client{Transport: &closingTransport{}}, time.Minute, log.NewUPPLogger("Test", "FATAL"))
+	require.NoError(t, err)
+	instance := &consumerInstance{config: QueueConfig{}, queue: defaultTestQueueCaller{}, shutdownChan: make(chan bool), processor: splitProcessor(func(m Message) {})}
+	c := Consumer{streamCount: 1, instanceHandlers: []instanceHandler{instance}, ageing: client}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		c.Start()
+		wg.Done()
+	}()
+	waitFor(t, func() bool {
+		client.state.mu.Lock()
+		defer client.state.mu.Unlock()
+		return client.state.done != nil
+	})
+	c.Stop()
+	wg.Wait()
+	assert.Nil(t, client.state.done)
+}
+
+func TestAgeingProcessIsSharedByCopies(t *testing.T) {
+	client, err := NewAgeingClient(&http.Client{Transport: &closingTransport{}}, time.Minute, log.NewUPPLogger("Test", "FATAL"))
+	require.NoError(t, err)
+	value := *client
+
+	value.StartAgeingProcess()
+	assert.NotNil(t, client.state.done)
+	client.StopAgeingProcess()
+	assert.Nil(t, value.state.done)
+}
+
+func TestAgeingProcessRunsWhileAnyConsumerIsStarted(t *testing.T) {
+	client, err := NewAgeingClient(&http.Client{Transport: &closingTransport{}}, time.Minute, log.NewUPPLogger("Test", "FATAL"))
+	require.NoError(t, err)
+	first, second := &http.Client{}, &http.Client{}
+
+	client.start(first)
+	client.start(second)
+	client.stop(first)
+	assert.NotNil(t, client.state.done, "the ageing should go on while a consumer is started")
+	assert.Equal(t, []*http.Client{second}, client.state.clients)
+
+	client.stop(second)
+	assert.Nil(t, client.state.done)
+	assert.Empty(t, client.state.clients)
+}
+
+func TestAgeingTransportRecyclesExpiredConnections(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	ageing, err := NewAgeingClient(server.Client(), 20*time.Millisecond, log.NewUPPLogger("Test", "FATAL"))
+	require.NoError(t, err)
+	ageing.PerConnection = true
+	aged := ageing.dialer(ageing.HTTPClient)
+	aged.Transport = wrappingTransport{aged.Transport}
+	client := httpClient{client: ageing.client(aged)}
+	reused := func() bool {
+		var reused bool
+		ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) {
+			reused = info.Reused
+		}})
+		_, err := client.DoReq(ctx, "GET", server.URL, nil, nil, http.StatusOK)
+		require.NoError(t, err)
+		return reused
+	}
+
+	assert.False(t, reused())
+	assert.True(t, reused(), "a young connection should be kept")
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, reused(), "the expired connection is used until the request completes")
+	assert.False(t, reused(), "the expired connection should have been closed")
+	assert.True(t, reused(), "the new connection should be kept")
+}
+
+func TestAgeingTransportClosesOnlyExpiredConnection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	ageing, err := NewAgeingClient(server.Client(), time.Hour, log.NewUPPLogger("Test", "FATAL"))
+	require.NoError(t, err)
+	ageing.PerConnection = true
+	client := ageing.client(ageing.dialer(ageing.HTTPClient))
+
+	conns := make(chan *ageingConn, 4)
+	get := func(ctx context.Context) *http.Response {
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) {
+			conns <- agedConn(info.Conn)
+		}})
+		req, err := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	// two concurrent requests open two connections
+	first, second := get(context.Background()), get(context.Background())
+	old, young := <-conns, <-conns
+	require.NotNil(t, old)
+	require.NotSame(t, old, young)
+	first.Body.Close()
+	second.Body.Close()
+
+	old.created = time.Now().Add(-2 * time.Hour)
+	first, second = get(context.Background()), get(context.Background())
+	<-conns
+	<-conns
+	first.Body.Close()
+	second.Body.Close()
+
+	_, err = old.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	assert.Error(t, err, "the expired connection should be closed")
+	_, err = young.Write([]byte{})
+	assert.NoError(t, err, "the young connection should be kept")
+}
+
+func TestPerConnectionAgeingFallsBackToPeriodicForOtherTransports(t *testing.T) {
+	client, err := NewAgeingClient(&http.Client{Transport: wrappingTransport{&closingTransport{}}}, time.Minute, log.NewUPPLogger("Test", "FATAL"))
+	require.NoError(t, err)
+	client.PerConnection = true
+
+	assert.Same(t, client.HTTPClient, client.client(client.dialer(client.HTTPClient)))
+	client.StartAgeingProcess()
+	defer client.StopAgeingProcess()
+	assert.NotNil(t, client.state.done)
+}
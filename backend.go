@@ -0,0 +1,114 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	log "github.com/Financial-Times/go-logger/v2"
+)
+
+// Backend is the transport a Consumer fetches records through.
+// Every stream of the Consumer creates its own instance on the backend, subscribes it,
+// fetches and commits records through it and closes it on shutdown or after a failure.
+// The Consumer calls the methods of an instance from a single goroutine,
+// but the instances of different streams are used concurrently.
+//
+// CreateInstance creates a consumer instance and returns its ID.
+//
+// Subscribe subscribes the instance to the topic of the backend.
+//
+// Fetch returns the next records of the instance. An empty slice means no records are available.
+// The Value of a record holds the raw FT message in the binary format, or the JSON value in the json and avro formats.
+//
+// Commit commits the offsets of the records processed by the instance.
+// If no offsets are given, all the records fetched by the instance must be committed.
+//
+// CloseInstance releases the instance.
+//
+// CheckConnectivity returns an error if the backend cannot be reached.
+type Backend interface {
+	CreateInstance() (string, error)
+	Subscribe(instance string) error
+	Fetch(instance string) ([]Record, error)
+	Commit(instance string, offsets []PartitionOffset) error
+	CloseInstance(instance string) error
+	CheckConnectivity() error
+}
+
+// KeepAliveBackend is implemented by the backends whose instances expire when they are not used.
+// KeepAlive is called instead of Fetch while the consumption is paused.
+type KeepAliveBackend interface {
+	Backend
+	KeepAlive(instance string) error
+}
+
+// NewBackendConsumer returns a new instance of a Consumer fetching the messages through the given backend.
+// The client is used to resolve the schemas of the avro format.
+func NewBackendConsumer(config QueueConfig, handler func(m Message) error, backend Backend, client *http.Client, logger *log.UPPLogger) (MessageConsumer, error) {
+	if backend == nil {
+		return nil, errNilBackend
+	}
+	queue := backendCaller{backend}
+	decode := newConfiguredValueDecoder(config, client)
+	return newStreamConsumer(config, func(config QueueConfig, limiter *rateLimiter) *consumerInstance {
+		return newConsumerInstance(config, handler, limiter, queue, decode, logger)
+	}), nil
+}
+
+// NewBatchedBackendConsumer returns a Consumer to manage batches of messages fetched through the given backend
+func NewBatchedBackendConsumer(config QueueConfig, handler func(m []Message) error, backend Backend, client *http.Client, logger *log.UPPLogger) (MessageConsumer, error) {
+	if backend == nil {
+		return nil, errNilBackend
+	}
+	queue := backendCaller{backend}
+	decode := newConfiguredValueDecoder(config, client)
+	return newStreamConsumer(config, func(config QueueConfig, limiter *rateLimiter) *consumerInstance {
+		return newBatchedConsumerInstance(config, handler, limiter, queue, decode, logger)
+	}), nil
+}
+
+var errNilBackend = errors.New("non-nil Backend required")
+
+// backendCaller adapts a Backend to the queueCaller used by the consumer instances.
+// The ID of the backend instance is kept as the base URI of the consumer instance.
+type backendCaller struct {
+	backend Backend
+}
+
+func (b backendCaller) createConsumerInstance() (consumerInstanceURI, error) {
+	id, err := b.backend.CreateInstance()
+	return consumerInstanceURI{BaseURI: id}, err
+}
+
+func (b backendCaller) destroyConsumerInstance(c consumerInstanceURI) error {
+	return b.backend.CloseInstance(c.BaseURI)
+}
+
+func (b backendCaller) subscribeConsumerInstance(c consumerInstanceURI) error {
+	return b.backend.Subscribe(c.BaseURI)
+}
+
+// destroyConsumerInstanceSubscription does nothing as closing an instance of a backend releases its subscription
+func (b backendCaller) destroyConsumerInstanceSubscription(c consumerInstanceURI) error {
+	return nil
+}
+
+func (b backendCaller) keepAliveConsumerInstance(c consumerInstanceURI) error {
+	if k, ok := b.backend.(KeepAliveBackend); ok {
+		return k.KeepAlive(c.BaseURI)
+	}
+	return nil
+}
+
+func (b backendCaller) consumeMessages(ctx context.Context, c consumerInstanceURI) ([]Record, error) {
+	return b.backend.Fetch(c.BaseURI)
+}
+
+func (b backendCaller) commitOffsets(ctx context.Context, c consumerInstanceURI, offsets []PartitionOffset) error {
+	return b.backend.Commit(c.BaseURI, offsets)
+}
+
+func (b backendCaller) checkConnectivity() error {
+	return b.backend.CheckConnectivity()
+}
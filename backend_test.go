@@ -0,0 +1,146 @@
+package consumer
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackendConsumerLifecycle(t *testing.T) {
+	backend := newMemoryBackend("FTMSG/1.0\nMessage-Id: 1\n\nfirst", "FTMSG/1.0\nMessage-Id: 2\n\nsecond")
+	handled := make(chan Message, 2)
+	c, err := NewBackendConsumer(QueueConfig{FetchTimeout: 10}, func(m Message) error {
+		handled <- m
+		return nil
+	}, backend, &http.Client{}, log.NewUPPLogger("Test", "FATAL"))
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		c.Start()
+		wg.Done()
+	}()
+	assert.Equal(t, Message{Headers: map[string]string{"Message-Id": "1"}, Body: "first"}, <-handled)
+	assert.Equal(t, Message{Headers: map[string]string{"Message-Id": "2"}, Body: "second"}, <-handled)
+	c.Stop()
+	wg.Wait()
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	assert.Equal(t, []string{"create 1", "subscribe 1", "commit 1", "close 1"}, backend.calls)
+	msg, err := c.ConnectivityCheck()
+	assert.NoError(t, err)
+	assert.Equal(t, "Connectivity to consumer proxies is OK.", msg)
+}
+
+func TestBackendCallerKeepAlive(t *testing.T) {
+	assert.NoError(t, backendCaller{&memoryBackend{}}.keepAliveConsumerInstance(*consInstTest))
+	assert.EqualError(t, backendCaller{&keepAliveMemoryBackend{}}.keepAliveConsumerInstance(*consInstTest), "expired")
+}
+
+// memoryBackend serves the given FT messages as a single batch and records the calls made to it
+type memoryBackend struct {
+	mu        sync.Mutex
+	records   []Record
+	instances int
+	calls     []string
+}
+
+func newMemoryBackend(msgs ...string) *memoryBackend {
+	b := &memoryBackend{}
+	for i, msg := range msgs {
+		b.records = append(b.records, Record{Topic: "test", Offset: i, Value: []byte(msg)})
+	}
+	return b
+}
+
+func (b *memoryBackend) record(call string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, call)
+}
+
+func (b *memoryBackend) CreateInstance() (string, error) {
+	b.mu.Lock()
+	b.instances++
+	id := strconv.Itoa(b.instances)
+	b.mu.Unlock()
+	b.record("create " + id)
+	return id, nil
+}
+
+func (b *memoryBackend) Subscribe(instance string) error {
+	b.record("subscribe " + instance)
+	return nil
+}
+
+func (b *memoryBackend) Fetch(instance string) ([]Record, error) {
+	b.mu.Lock()
+	records := b.records
+	b.records = nil
+	b.mu.Unlock()
+	if len(records) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return records, nil
+}
+
+func (b *memoryBackend) Commit(instance string, offsets []PartitionOffset) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.calls) == 0 || b.calls[len(b.calls)-1] != "commit "+instance {
+		b.calls = append(b.calls, "commit "+instance)
+	}
+	return nil
+}
+
+func (b *memoryBackend) CloseInstance(instance string) error {
+	b.record("close " + instance)
+	return nil
+}
+
+func (b *memoryBackend) CheckConnectivity() error {
+	return nil
+}
+
+type keepAliveMemoryBackend struct {
+	memoryBackend
+}
+
+func (b *keepAliveMemoryBackend) KeepAlive(instance string) error {
+	return errors.New("expired")
+}
+
+func TestRecordValueIsDecodedPerFormat(t *testing.T) {
+	data := []byte(`[{"topic":"a","value":"Ym9keQ==","partition":0,"offset":1}]`)
+	records, err := parseFormatRecords(data, BinaryFormat)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("body"), records[0].Value)
+
+	data = []byte(`[{"topic":"a","value":{"uuid":"1"},"partition":0,"offset":1}]`)
+	records, err = parseFormatRecords(data, JSONFormat)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`{"uuid":"1"}`), records[0].Value)
+
+	line, err := json.Marshal(records[0])
+	assert.NoError(t, err)
+	replayed, err := parseReplayLine(line)
+	assert.NoError(t, err)
+	assert.Equal(t, records[0].Value, replayed[0].Value, "recorded records should replay with the same value")
+}
+
+func TestBackendConsumerRequiresBackend(t *testing.T) {
+	_, err := NewBackendConsumer(QueueConfig{}, func(m Message) error { return nil }, nil, &http.Client{}, log.NewUPPLogger("Test", "FATAL"))
+	assert.Equal(t, errNilBackend, err)
+
+	_, err = NewBatchedBackendConsumer(QueueConfig{}, func(m []Message) error { return nil }, nil, &http.Client{}, log.NewUPPLogger("Test", "FATAL"))
+	assert.Equal(t, errNilBackend, err)
+}
@@ -0,0 +1,76 @@
+package consumer
+
+import "time"
+
+const (
+	defaultMaxBatchWait = 1000
+	batchPollInterval   = 100 * time.Millisecond
+)
+
+// accumulates reports whether the batches handed to the processor are accumulated across polls.
+// Only batches are accumulated, the messages handled one by one are handed over as soon as they are fetched.
+func (c *consumerInstance) accumulates() bool {
+	return c.batched && (c.config.MaxBatchSize > 0 || c.config.MaxBatchBytes > 0 || c.config.MaxBatchWait > 0)
+}
+
+func (c *consumerInstance) maxBatchWait() time.Duration {
+	wait := defaultMaxBatchWait
+	if c.config.MaxBatchWait > 0 {
+		wait = c.config.MaxBatchWait
+	}
+	return time.Duration(wait) * time.Millisecond
+}
+
+// accumulate fetches batches until MaxBatchSize messages or MaxBatchBytes bytes of message bodies are fetched,
+// or MaxBatchWait has elapsed since the accumulation started. The long polls are cut short at the end of the wait.
+// The messages fetched over MaxBatchSize are carried over to the next batch, so the offsets of a batch only cover
+// the messages handed to the processor.
+func (c *consumerInstance) accumulate() (batch, error) {
+	deadline := time.Now().Add(c.maxBatchWait())
+	b := c.carried
+	c.carried = batch{}
+	for !c.batchFull(b) && time.Now().Before(deadline) {
+		next, err := c.nextBatch(deadline)
+		if err != nil {
+			return batch{}, err
+		}
+		b.msgs = append(b.msgs, next.msgs...)
+		b.offsets = mergeOffsets(b.offsets, next.offsets...)
+
+		if len(next.offsets) == 0 && c.config.FetchTimeout <= 0 {
+			// without long polling the proxy returns immediately when no records are available
+			time.Sleep(minDuration(batchPollInterval, time.Until(deadline)))
+		}
+	}
+
+	if c.config.MaxBatchSize <= 0 || len(b.msgs) <= c.config.MaxBatchSize {
+		return b, nil
+	}
+	c.carried = batch{msgs: b.msgs[c.config.MaxBatchSize:], offsets: b.offsets}
+	handed := batch{msgs: b.msgs[:c.config.MaxBatchSize:c.config.MaxBatchSize]}
+	for _, m := range handed.msgs {
+		handed.offsets = mergeOffsets(handed.offsets, m.position)
+	}
+	return handed, nil
+}
+
+func (c *consumerInstance) batchFull(b batch) bool {
+	if c.config.MaxBatchSize > 0 && len(b.msgs) >= c.config.MaxBatchSize {
+		return true
+	}
+	if c.config.MaxBatchBytes > 0 {
+		size := 0
+		for _, m := range b.msgs {
+			size += len(m.Body)
+		}
+		return size >= c.config.MaxBatchBytes
+	}
+	return false
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
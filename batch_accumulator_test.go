@@ -0,0 +1,141 @@
+package consumer
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptedQueueCaller returns records with the given offsets on every request, then no records, and records the commits
+type scriptedQueueCaller struct {
+	defaultTestQueueCaller
+	fetches [][]int
+	commits [][]PartitionOffset
+}
+
+func (qc *scriptedQueueCaller) consumeMessages(ctx context.Context, cInst consumerInstanceURI) ([]Record, error) {
+	if len(qc.fetches) == 0 {
+		return nil, nil
+	}
+	var records []string
+	for _, offset := range qc.fetches[0] {
+		records = append(records, offsetRecord(offset))
+	}
+	qc.fetches = qc.fetches[1:]
+	return parseRecords([]byte("[" + strings.Join(records, ",") + "]"))
+}
+
+func (qc *scriptedQueueCaller) commitOffsets(ctx context.Context, cInst consumerInstanceURI, offsets []PartitionOffset) error {
+	qc.commits = append(qc.commits, offsets)
+	return nil
+}
+
+// offsetRecord returns a record of the test topic whose message body is its offset padded to 4 digits
+func offsetRecord(offset int) string {
+	value := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("FTMSG/1.0\n\n%04d\n", offset)))
+	return fmt.Sprintf(`{"topic":"test","value":%q,"partition":0,"offset":%d}`, value, offset)
+}
+
+func offsetsOf(msgs []Message) []int {
+	var offsets []int
+	for _, m := range msgs {
+		offset, _ := strconv.Atoi(m.Body)
+		offsets = append(offsets, offset)
+	}
+	return offsets
+}
+
+func TestAccumulateUpToMaxBatchSize(t *testing.T) {
+	queue := &scriptedQueueCaller{fetches: [][]int{{0, 1}, {2, 3}, {4, 5}}}
+	var batches [][]int
+	c := &consumerInstance{config: QueueConfig{MaxBatchSize: 3}, queue: queue, consumer: consInstTest, batched: true, logger: log.NewUPPLogger("Test", "FATAL"),
+		processor: batchedProcessor(func(m []Message) {
+			batches = append(batches, offsetsOf(m))
+		})}
+
+	_, err := c.consume()
+	assert.NoError(t, err)
+	_, err = c.consume()
+	assert.NoError(t, err)
+
+	assert.Equal(t, [][]int{{0, 1, 2}, {3, 4, 5}}, batches)
+	assert.Equal(t, [][]PartitionOffset{{{"test", 0, 2}}, {{"test", 0, 5}}}, queue.commits,
+		"only the offsets of the handled messages should be committed")
+}
+
+func TestAccumulateUpToMaxBatchBytes(t *testing.T) {
+	queue := &scriptedQueueCaller{fetches: [][]int{{0}, {1}, {2}}}
+	c := &consumerInstance{config: QueueConfig{MaxBatchBytes: 8}, queue: queue, consumer: consInstTest, batched: true, logger: log.NewUPPLogger("Test", "FATAL")}
+
+	b, err := c.fetch()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, offsetsOf(messagesOf(b.msgs)), "two message bodies of 4 bytes should fill the batch")
+}
+
+func TestAccumulateUntilMaxBatchWait(t *testing.T) {
+	queue := &scriptedQueueCaller{fetches: [][]int{{0}}}
+	c := &consumerInstance{config: QueueConfig{MaxBatchSize: 10, MaxBatchWait: 50}, queue: queue, consumer: consInstTest, batched: true, logger: log.NewUPPLogger("Test", "FATAL")}
+
+	start := time.Now()
+	b, err := c.fetch()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0}, offsetsOf(messagesOf(b.msgs)))
+	assert.True(t, time.Since(start) >= 50*time.Millisecond, "the batch should be handed over once the wait elapsed")
+}
+
+func TestCarriedMessagesAreDroppedOnShutdown(t *testing.T) {
+	queue := &scriptedQueueCaller{fetches: [][]int{{0, 1, 2}}}
+	c := &consumerInstance{config: QueueConfig{MaxBatchSize: 2}, queue: queue, consumer: consInstTest, batched: true, logger: log.NewUPPLogger("Test", "FATAL")}
+
+	b, err := c.fetch()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, offsetsOf(messagesOf(b.msgs)))
+
+	c.shutdown()
+	assert.Empty(t, c.carried.msgs, "the uncommitted messages are redelivered to the new consumer instance")
+}
+
+func TestAccumulationCapsLongPolls(t *testing.T) {
+	queue := &timeoutQueueCaller{}
+	c := &consumerInstance{config: QueueConfig{MaxBatchSize: 10, MaxBatchWait: 200, FetchTimeout: 30000}, queue: queue, consumer: consInstTest,
+		batched: true, logger: log.NewUPPLogger("Test", "FATAL")}
+
+	_, err := c.fetch()
+
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, queue.timeouts) {
+		for _, timeout := range queue.timeouts {
+			assert.LessOrEqual(t, timeout, 200, "no request should outlast the batch wait")
+		}
+	}
+}
+
+func TestMessagesHandledOneByOneAreNotAccumulated(t *testing.T) {
+	c := &consumerInstance{config: QueueConfig{MaxBatchSize: 10, MaxBatchWait: 50}}
+	assert.False(t, c.accumulates())
+
+	c.batched = true
+	assert.True(t, c.accumulates())
+}
+
+// timeoutQueueCaller records the timeout of every records request, which waits for it like a long poll without records
+type timeoutQueueCaller struct {
+	defaultTestQueueCaller
+	timeouts []int
+}
+
+func (qc *timeoutQueueCaller) consumeMessages(ctx context.Context, cInst consumerInstanceURI) ([]Record, error) {
+	timeout := fetchTimeout(ctx, 30000)
+	qc.timeouts = append(qc.timeouts, timeout)
+	time.Sleep(time.Duration(timeout) * time.Millisecond)
+	return nil, nil
+}
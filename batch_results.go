@@ -0,0 +1,135 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	log "github.com/Financial-Times/go-logger/v2"
+)
+
+// Headers added to the messages written to the dead letter topic
+const (
+	DeadLetterErrorHeader     = "X-Dead-Letter-Error"
+	DeadLetterTopicHeader     = "X-Dead-Letter-Topic"
+	DeadLetterPartitionHeader = "X-Dead-Letter-Partition"
+	DeadLetterOffsetHeader    = "X-Dead-Letter-Offset"
+)
+
+// ErrNoDeadLetterSupport is returned when a DeadLetterTopic is configured with an API version which cannot produce records
+var ErrNoDeadLetterSupport = errors.New("dead lettering requires the v3 API")
+
+// deadLetterCaller is implemented by the queue callers which can write the messages which failed to a dead letter topic
+type deadLetterCaller interface {
+	produceRecord(topic string, value []byte, headers map[string]string) error
+}
+
+// partialFailure is returned by the handler of a batch when some of its messages failed.
+// Only the failed messages are kept as pending by the circuit breaker.
+type partialFailure struct {
+	failed []delivery
+	errs   []error
+}
+
+func (f *partialFailure) Error() string {
+	return fmt.Sprintf("%d messages failed, first error: %v", len(f.failed), f.errs[0])
+}
+
+// NewBatchedResultConsumer returns a Consumer to manage batches of messages with a handler reporting the result of
+// every message. The handler returns an error for each message of the batch, nil for the messages handled successfully,
+// or a nil slice if all of them succeeded. The failed messages are handed to the handler again up to
+// QueueConfig.BatchRetries times and then written to QueueConfig.DeadLetterTopic, if configured.
+// The messages which could be neither handled nor dead-lettered count as a failure for the circuit breaker,
+// which opens on the first one if it is disabled, so they are retried and never committed.
+// Like the other constructors validating their arguments, it returns an error for an invalid config:
+// ErrNoDeadLetterSupport if a DeadLetterTopic is set and the APIVersion is not v3.
+func NewBatchedResultConsumer(config QueueConfig, handler func(m []Message) []error, client *http.Client, logger *log.UPPLogger) (MessageConsumer, error) {
+	if config.DeadLetterTopic != "" && config.APIVersion != APIv3 {
+		return nil, ErrNoDeadLetterSupport
+	}
+	if config.CircuitBreakerThreshold <= 0 {
+		// the messages which could be neither handled nor dead-lettered must not be committed
+		config.CircuitBreakerThreshold = 1
+	}
+	newQueue := queueCallers(config, client, nil)
+	return newStreamConsumer(config, func(config QueueConfig, limiter *rateLimiter) *consumerInstance {
+		queue := newQueue(config)
+		return newDeliveryConsumerInstance(config, resultHandler(config, handler, queue, logger), limiter, queue, newConfiguredValueDecoder(config, client), logger)
+	}), nil
+}
+
+// resultHandler adapts a handler reporting the result of every message to a batch handler
+// retrying and dead-lettering the failed messages
+func resultHandler(config QueueConfig, handler func(m []Message) []error, queue queueCaller, logger *log.UPPLogger) func(msgs []delivery) error {
+	return func(msgs []delivery) error {
+		failed, errs := handleBatch(handler, msgs)
+		for retry := 0; retry < config.BatchRetries && len(failed) > 0; retry++ {
+			failed, errs = handleBatch(handler, failed)
+		}
+		if len(failed) == 0 {
+			return nil
+		}
+		if config.DeadLetterTopic == "" {
+			return &partialFailure{failed, errs}
+		}
+
+		var undelivered []delivery
+		var undeliveredErrs []error
+		for i, m := range failed {
+			if err := deadLetter(queue, config.DeadLetterTopic, m, errs[i]); err != nil {
+				logger.WithError(err).WithTransactionID(m.Headers[requestIDHeader]).Error("Error writing message to dead letter topic")
+				undelivered = append(undelivered, m)
+				undeliveredErrs = append(undeliveredErrs, errs[i])
+				continue
+			}
+			logger.WithError(errs[i]).WithTransactionID(m.Headers[requestIDHeader]).Warnf("Message written to dead letter topic %s", config.DeadLetterTopic)
+		}
+		if len(undelivered) > 0 {
+			return &partialFailure{undelivered, undeliveredErrs}
+		}
+		return nil
+	}
+}
+
+// handleBatch hands the messages to the handler and returns the failed ones with their errors
+func handleBatch(handler func(m []Message) []error, msgs []delivery) ([]delivery, []error) {
+	results := handler(messagesOf(msgs))
+	if results == nil {
+		return nil, nil
+	}
+	if len(results) != len(msgs) {
+		err := fmt.Errorf("handler returned %d results for %d messages", len(results), len(msgs))
+		errs := make([]error, len(msgs))
+		for i := range errs {
+			errs[i] = err
+		}
+		return msgs, errs
+	}
+
+	var failed []delivery
+	var errs []error
+	for i, err := range results {
+		if err != nil {
+			failed = append(failed, msgs[i])
+			errs = append(errs, err)
+		}
+	}
+	return failed, errs
+}
+
+func deadLetter(queue queueCaller, topic string, m delivery, cause error) error {
+	q, ok := queue.(deadLetterCaller)
+	if !ok {
+		return ErrNoDeadLetterSupport
+	}
+	headers := make(map[string]string, len(m.Headers)+4)
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	headers[DeadLetterErrorHeader] = cause.Error()
+	headers[DeadLetterTopicHeader] = m.position.Topic
+	headers[DeadLetterPartitionHeader] = strconv.Itoa(m.position.Partition)
+	headers[DeadLetterOffsetHeader] = strconv.Itoa(m.position.Offset)
+	return q.produceRecord(topic, []byte(m.Body), headers)
+}
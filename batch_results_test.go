@@ -0,0 +1,141 @@
+package consumer
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type producedRecord struct {
+	topic   string
+	value   string
+	headers map[string]string
+}
+
+type deadLetterTestQueueCaller struct {
+	defaultTestQueueCaller
+	produced []producedRecord
+	err      error
+}
+
+func (qc *deadLetterTestQueueCaller) produceRecord(topic string, value []byte, headers map[string]string) error {
+	if qc.err != nil {
+		return qc.err
+	}
+	qc.produced = append(qc.produced, producedRecord{topic, string(value), headers})
+	return nil
+}
+
+// failingHandler fails the messages with the given bodies and records the batches it was called with
+type failingHandler struct {
+	failing map[string]bool
+	batches [][]Message
+}
+
+func (h *failingHandler) handle(msgs []Message) []error {
+	h.batches = append(h.batches, msgs)
+	var errs []error
+	for i, m := range msgs {
+		if h.failing[m.Body] {
+			if errs == nil {
+				errs = make([]error, len(msgs))
+			}
+			errs[i] = errors.New("downstream failure")
+		}
+	}
+	return errs
+}
+
+func TestHandleBatch(t *testing.T) {
+	failed, errs := handleBatch(func(m []Message) []error { return nil }, deliveriesTest)
+	assert.Empty(t, failed)
+	assert.Empty(t, errs)
+
+	failed, errs = handleBatch(func(m []Message) []error { return []error{nil, errors.New("downstream failure")} }, deliveriesTest)
+	assert.Equal(t, deliveriesTest[1:], failed)
+	assert.EqualError(t, errs[0], "downstream failure")
+
+	failed, errs = handleBatch(func(m []Message) []error { return []error{nil} }, deliveriesTest)
+	assert.Equal(t, deliveriesTest, failed, "all messages should fail when the results do not match the batch")
+	assert.EqualError(t, errs[1], "handler returned 1 results for 2 messages")
+}
+
+func TestResultHandlerRetriesFailedMessages(t *testing.T) {
+	h := &failingHandler{failing: map[string]bool{"[]": true}}
+	handle := resultHandler(QueueConfig{BatchRetries: 2}, h.handle, defaultTestQueueCaller{}, log.NewUPPLogger("Test", "FATAL"))
+
+	err := handle(deliveriesTest)
+
+	var partial *partialFailure
+	if assert.True(t, errors.As(err, &partial)) {
+		assert.Equal(t, deliveriesTest[1:], partial.failed)
+	}
+	assert.Equal(t, [][]Message{msgsTest, msgsTest[1:], msgsTest[1:]}, h.batches, "only the failed messages should be retried")
+}
+
+func TestResultHandlerDeadLettersFailedMessages(t *testing.T) {
+	h := &failingHandler{failing: map[string]bool{"[]": true}}
+	queue := &deadLetterTestQueueCaller{}
+	handle := resultHandler(QueueConfig{BatchRetries: 1, DeadLetterTopic: "dead-letters"}, h.handle, queue, log.NewUPPLogger("Test", "FATAL"))
+
+	assert.NoError(t, handle(deliveriesTest))
+	assert.Equal(t, []producedRecord{{
+		topic: "dead-letters",
+		value: "[]",
+		headers: map[string]string{
+			"Message-Id":              "0000-1111-0000-abcd",
+			DeadLetterErrorHeader:     "downstream failure",
+			DeadLetterTopicHeader:     "test",
+			DeadLetterPartitionHeader: "0",
+			DeadLetterOffsetHeader:    "1",
+		},
+	}}, queue.produced)
+}
+
+func TestResultHandlerKeepsMessagesWhichCannotBeDeadLettered(t *testing.T) {
+	h := &failingHandler{failing: map[string]bool{"body": true, "[]": true}}
+	queue := &deadLetterTestQueueCaller{err: errors.New("proxy unavailable")}
+	handle := resultHandler(QueueConfig{DeadLetterTopic: "dead-letters"}, h.handle, queue, log.NewUPPLogger("Test", "FATAL"))
+
+	err := handle(deliveriesTest)
+
+	var partial *partialFailure
+	if assert.True(t, errors.As(err, &partial)) {
+		assert.Equal(t, deliveriesTest, partial.failed)
+	}
+
+	handle = resultHandler(QueueConfig{DeadLetterTopic: "dead-letters"}, h.handle, defaultTestQueueCaller{}, log.NewUPPLogger("Test", "FATAL"))
+	assert.Error(t, handle(deliveriesTest), "dead lettering should fail without the v3 API")
+}
+
+func TestCircuitBreakerKeepsOnlyFailedMessagesOfBatch(t *testing.T) {
+	h := &failingHandler{failing: map[string]bool{"[]": true}}
+	logger := log.NewUPPLogger("Test", "FATAL")
+	b := newCircuitBreaker(QueueConfig{CircuitBreakerThreshold: 1}, resultHandler(QueueConfig{}, h.handle, defaultTestQueueCaller{}, logger), logger)
+
+	b.execute(deliveriesTest)
+
+	assert.False(t, b.closed())
+	assert.Equal(t, deliveriesTest[1:], b.pending)
+}
+
+func TestNewBatchedResultConsumerRequiresV3ForDeadLettering(t *testing.T) {
+	handler := func(m []Message) []error { return nil }
+	logger := log.NewUPPLogger("Test", "FATAL")
+
+	_, err := NewBatchedResultConsumer(QueueConfig{DeadLetterTopic: "dead-letters"}, handler, &http.Client{}, logger)
+	assert.ErrorIs(t, err, ErrNoDeadLetterSupport)
+
+	c, err := NewBatchedResultConsumer(QueueConfig{APIVersion: APIv3, DeadLetterTopic: "dead-letters"}, handler, &http.Client{}, logger)
+	assert.NoError(t, err)
+	instance := c.(*Consumer).instanceHandlers[0].(*consumerInstance)
+	assert.Equal(t, 1, instance.breaker.threshold, "the messages which could not be dead-lettered should not be committed")
+
+	c, err = NewBatchedResultConsumer(QueueConfig{}, handler, &http.Client{}, logger)
+	assert.NoError(t, err, "a v2 consumer without a dead letter topic should be accepted")
+	instance = c.(*Consumer).instanceHandlers[0].(*consumerInstance)
+	assert.Equal(t, 1, instance.breaker.threshold, "the failed messages should be retried instead of committed")
+}
@@ -0,0 +1,190 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Financial-Times/go-logger/v2"
+)
+
+const defaultCircuitBreakerCoolDown = 30
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker guards the message handler of a consumer instance.
+// After threshold consecutive handler failures it opens, which stops the fetching of new messages.
+// The messages which could not be handled are kept as pending, so their offsets are not committed. While the breaker
+// is closed they are handled again before new messages are fetched, once it opens the first of them is used
+// to probe the handler once the cool-down period has elapsed.
+// A threshold of 0 disables the breaker, failures are only logged.
+type circuitBreaker struct {
+	threshold int
+	coolDown  time.Duration
+	handle    func(msgs []delivery) error
+	logger    *log.UPPLogger
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	since    time.Time
+	pending  []delivery
+}
+
+func newCircuitBreaker(config QueueConfig, handle func(msgs []delivery) error, logger *log.UPPLogger) *circuitBreaker {
+	coolDown := defaultCircuitBreakerCoolDown
+	if config.CircuitBreakerCoolDown > 0 {
+		coolDown = config.CircuitBreakerCoolDown
+	}
+	return &circuitBreaker{
+		threshold: config.CircuitBreakerThreshold,
+		coolDown:  time.Duration(coolDown) * time.Second,
+		handle:    handle,
+		logger:    logger,
+		since:     time.Now(),
+	}
+}
+
+// execute hands the messages to the handler if the breaker is closed, otherwise it keeps them as pending.
+// It is safe to be called concurrently.
+func (b *circuitBreaker) execute(msgs []delivery) {
+	b.mu.Lock()
+	if b.state != breakerClosed {
+		b.pending = append(b.pending, msgs...)
+		b.mu.Unlock()
+		return
+	}
+	b.mu.Unlock()
+
+	err := b.handle(msgs)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		return
+	}
+
+	b.logger.WithError(err).Error("Error handling messages")
+	var partial *partialFailure
+	if errors.As(err, &partial) {
+		// the messages handled successfully must not be handled again
+		msgs = partial.failed
+	}
+	if b.threshold <= 0 {
+		return
+	}
+	b.failures++
+	if b.state == breakerClosed && b.failures >= b.threshold {
+		b.transition(breakerOpen)
+	}
+	b.pending = append(b.pending, msgs...)
+}
+
+// closed reports whether new messages can be fetched and handled.
+func (b *circuitBreaker) closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == breakerClosed
+}
+
+// coolingDown reports whether the breaker is open and has to wait more before probing the handler.
+func (b *circuitBreaker) coolingDown() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == breakerOpen && time.Since(b.since) < b.coolDown
+}
+
+func (b *circuitBreaker) hasPending() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending) > 0
+}
+
+// hold keeps the messages as pending without handling them.
+func (b *circuitBreaker) hold(msgs []delivery) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, msgs...)
+}
+
+// takePending returns the pending messages to be handled again, and forgets them.
+func (b *circuitBreaker) takePending() []delivery {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pending := b.pending
+	b.pending = nil
+	return pending
+}
+
+// dropPending discards the pending messages.
+// This is needed when the consumer instance is recreated as the uncommitted messages are redelivered.
+func (b *circuitBreaker) dropPending() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = nil
+}
+
+// probe hands the first pending message to the handler.
+// If the handler succeeds the breaker closes and the rest of the pending messages are returned
+// to be processed normally. If it fails the breaker opens again for another cool-down period.
+func (b *circuitBreaker) probe() ([]delivery, bool) {
+	b.mu.Lock()
+	if len(b.pending) == 0 {
+		b.mu.Unlock()
+		return nil, false
+	}
+	b.transition(breakerHalfOpen)
+	probe := b.pending[0]
+	b.mu.Unlock()
+
+	err := b.handle([]delivery{probe})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.logger.WithError(err).Error("Error handling probe message")
+		b.transition(breakerOpen)
+		return nil, false
+	}
+
+	remaining := b.pending[1:]
+	b.pending = nil
+	b.transition(breakerClosed)
+	b.failures = 0
+	return remaining, true
+}
+
+// transition must be called with the lock held.
+func (b *circuitBreaker) transition(state breakerState) {
+	b.logger.Infof("Circuit breaker transitioned from %s to %s after %d consecutive handler failures", b.state, state, b.failures)
+	b.state = state
+	b.since = time.Now()
+}
+
+func (b *circuitBreaker) check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerClosed {
+		return nil
+	}
+	return fmt.Errorf("circuit breaker %s since %s after %d consecutive handler failures; ", b.state, b.since.Format(time.RFC3339), b.failures)
+}
@@ -0,0 +1,117 @@
+package consumer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	logger := log.NewUPPLogger("Test", "FATAL")
+	handled := 0
+	b := newCircuitBreaker(QueueConfig{CircuitBreakerThreshold: 2}, func(msgs []delivery) error {
+		handled++
+		return errors.New("downstream failure")
+	}, logger)
+
+	b.execute(deliveriesTest[:1])
+	assert.True(t, b.closed())
+	assert.True(t, b.hasPending(), "failures under the threshold should be kept to be handled again")
+
+	b.execute(deliveriesTest[1:])
+	assert.False(t, b.closed())
+	assert.True(t, b.coolingDown())
+	assert.EqualError(t, b.check(), "circuit breaker open since "+b.since.Format(time.RFC3339)+" after 2 consecutive handler failures; ")
+
+	b.execute(deliveriesTest[:1])
+	assert.Equal(t, 2, handled, "the handler should not be called while the breaker is open")
+	assert.Equal(t, []delivery{deliveriesTest[0], deliveriesTest[1], deliveriesTest[0]}, b.pending)
+}
+
+func TestFailuresUnderThresholdAreRetriedBeforeCommitting(t *testing.T) {
+	queue := &scriptedQueueCaller{fetches: [][]int{{0, 1}, {2}}}
+	failures := 1
+	var handled []int
+	c := newConsumerInstance(QueueConfig{CircuitBreakerThreshold: 3}, func(m Message) error {
+		if m.Body == "0001" && failures > 0 {
+			failures--
+			return errors.New("downstream failure")
+		}
+		handled = append(handled, offsetsOf([]Message{m})...)
+		return nil
+	}, nil, queue, nil, log.NewUPPLogger("Test", "FATAL"))
+	c.consumer = consInstTest
+
+	_, err := c.consume()
+	assert.NoError(t, err)
+	assert.True(t, c.breaker.closed())
+	assert.Empty(t, queue.commits, "the failed message should not be committed")
+
+	_, err = c.consume()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, handled, "the failed message should be handled again before new ones are fetched")
+	assert.Len(t, queue.fetches, 1)
+	assert.Len(t, queue.commits, 1)
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := newCircuitBreaker(QueueConfig{}, func(msgs []delivery) error {
+		return errors.New("downstream failure")
+	}, log.NewUPPLogger("Test", "FATAL"))
+
+	for i := 0; i < 10; i++ {
+		b.execute(deliveriesTest)
+	}
+	assert.True(t, b.closed())
+	assert.NoError(t, b.check())
+}
+
+func TestCircuitBreakerStopsFetchingAndRecoversAfterProbe(t *testing.T) {
+	logger := log.NewUPPLogger("Test", "FATAL")
+	queue := &countingTestQueueCaller{}
+	failing := true
+	var handled []Message
+	c := newConsumerInstance(QueueConfig{CircuitBreakerThreshold: 1, CircuitBreakerCoolDown: 1}, func(m Message) error {
+		if failing {
+			return errors.New("downstream failure")
+		}
+		handled = append(handled, m)
+		return nil
+	}, nil, queue, nil, logger)
+
+	_, err := c.consume()
+	assert.NoError(t, err)
+	assert.Error(t, c.checkCircuitBreaker())
+	assert.Equal(t, int32(1), queue.fetches.Load())
+	assert.Equal(t, msgsTest, messagesOf(c.breaker.pending))
+
+	msgs, err := c.consume()
+	assert.NoError(t, err)
+	assert.Empty(t, msgs)
+	assert.Equal(t, int32(1), queue.fetches.Load(), "no messages should be fetched while the breaker is open")
+	assert.Equal(t, int32(1), queue.keepAlives.Load())
+
+	c.breaker.since = time.Now().Add(-time.Second)
+	msgs, err = c.consume()
+	assert.NoError(t, err)
+	assert.Empty(t, msgs)
+	assert.Equal(t, int32(1), queue.fetches.Load(), "the probe should use a pending message")
+	assert.True(t, c.breaker.coolingDown(), "a failed probe should reopen the breaker")
+
+	failing = false
+	c.breaker.since = time.Now().Add(-time.Second)
+	msgs, err = c.consume()
+	assert.NoError(t, err)
+	assert.Equal(t, msgsTest[1:], messagesOf(msgs))
+	assert.Equal(t, msgsTest, handled)
+	assert.NoError(t, c.checkCircuitBreaker())
+	assert.Equal(t, int32(1), queue.fetches.Load())
+
+	msgs, err = c.consume()
+	assert.NoError(t, err)
+	assert.Equal(t, msgsTest, messagesOf(msgs))
+	assert.Equal(t, int32(2), queue.fetches.Load())
+}
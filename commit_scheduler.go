@@ -0,0 +1,101 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// commitScheduler defers the commits of a consumer instance in manual commit mode until every messages
+// are processed or interval has elapsed since the last commit. The offsets of the processed messages
+// are committed anyway before the consumer instance is destroyed. The REST proxy rebalances the group
+// while serving a records request, before the offsets pending on the revoked partitions can be committed,
+// so they are dropped once the revocation is seen and their messages are redelivered to the new owners.
+// A nil commitScheduler lets every poll be committed.
+type commitScheduler struct {
+	every    int
+	interval time.Duration
+
+	count   int
+	since   time.Time
+	offsets []PartitionOffset
+}
+
+// newCommitScheduler returns a commitScheduler for the config, or nil if every poll is committed
+func newCommitScheduler(config QueueConfig) *commitScheduler {
+	if config.AutoCommitEnable || (config.CommitEvery <= 0 && config.CommitInterval <= 0) {
+		return nil
+	}
+	return &commitScheduler{
+		every:    config.CommitEvery,
+		interval: time.Duration(config.CommitInterval) * time.Second,
+		since:    time.Now(),
+	}
+}
+
+// add records the offsets of processed messages
+func (s *commitScheduler) add(offsets []PartitionOffset, count int) {
+	s.offsets = mergeOffsets(s.offsets, offsets...)
+	s.count += count
+}
+
+// revoke drops the offsets pending on the revoked partitions, which must not overwrite the progress of their new owners
+func (s *commitScheduler) revoke(partitions []TopicPartition) {
+	if s == nil || len(partitions) == 0 {
+		return
+	}
+	revoked := make(map[TopicPartition]bool, len(partitions))
+	for _, p := range partitions {
+		revoked[p] = true
+	}
+	var offsets []PartitionOffset
+	for _, o := range s.offsets {
+		if !revoked[TopicPartition{Topic: o.Topic, Partition: o.Partition}] {
+			offsets = append(offsets, o)
+		}
+	}
+	s.offsets = offsets
+}
+
+func (s *commitScheduler) due() bool {
+	if len(s.offsets) == 0 {
+		return false
+	}
+	return (s.every > 0 && s.count >= s.every) ||
+		(s.interval > 0 && time.Since(s.since) >= s.interval)
+}
+
+func (s *commitScheduler) reset() {
+	if s == nil {
+		return
+	}
+	s.count = 0
+	s.since = time.Now()
+	s.offsets = nil
+}
+
+// commitScheduled commits the offsets of the messages processed since the last scheduled commit.
+// The offsets are kept when the commit fails, so they are committed again before the consumer instance is destroyed.
+func (c *consumerInstance) commitScheduled() (err error) {
+	offsets := c.commits.offsets
+	ctx, span := c.startSpan(context.Background(), "commit", attribute.Int("messaging.kafka.partition_count", len(offsets)))
+	defer func() { endSpan(span, err) }()
+	if err := c.queue.commitOffsets(ctx, *c.consumer, offsets); err != nil {
+		return err
+	}
+	c.commits.reset()
+	c.observer().Committed(c.instanceID(), offsets)
+	return nil
+}
+
+// commitOnShutdown commits the offsets whose scheduled commit is still pending before the consumer instance is destroyed
+func (c *consumerInstance) commitOnShutdown() {
+	if c.commits == nil || c.consumer == nil || len(c.commits.offsets) == 0 {
+		return
+	}
+	if err := c.commitScheduled(); err != nil {
+		c.logger.WithError(err).Error("Error committing offsets before destroying consumer instance")
+		c.observer().CommitFailed(c.instanceID(), err)
+	}
+}
@@ -0,0 +1,99 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitEveryNMessages(t *testing.T) {
+	queue := &scriptedQueueCaller{fetches: [][]int{{0}, {1, 2}, {3}}}
+	config := QueueConfig{CommitEvery: 3}
+	c := &consumerInstance{config: config, queue: queue, consumer: consInstTest, commits: newCommitScheduler(config),
+		processor: splitProcessor(func(m Message) {}), logger: log.NewUPPLogger("Test", "FATAL")}
+
+	for i := 0; i < 3; i++ {
+		_, err := c.consume()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, [][]PartitionOffset{{{Topic: "test", Partition: 0, Offset: 2}}}, queue.commits)
+
+	c.shutdown()
+	assert.Equal(t, [][]PartitionOffset{
+		{{Topic: "test", Partition: 0, Offset: 2}},
+		{{Topic: "test", Partition: 0, Offset: 3}},
+	}, queue.commits, "the processed offsets should be committed before the instance is destroyed")
+}
+
+func TestCommitInterval(t *testing.T) {
+	queue := &scriptedQueueCaller{fetches: [][]int{{0}, {1}}}
+	config := QueueConfig{CommitInterval: 60}
+	c := &consumerInstance{config: config, queue: queue, consumer: consInstTest, commits: newCommitScheduler(config),
+		processor: splitProcessor(func(m Message) {}), logger: log.NewUPPLogger("Test", "FATAL")}
+
+	_, err := c.consume()
+	assert.NoError(t, err)
+	assert.Empty(t, queue.commits)
+
+	c.commits.since = time.Now().Add(-time.Minute)
+	_, err = c.consume()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]PartitionOffset{{{Topic: "test", Partition: 0, Offset: 1}}}, queue.commits)
+}
+
+// failingCommitQueueCaller fails the first commit
+type failingCommitQueueCaller struct {
+	scriptedQueueCaller
+	failed bool
+}
+
+func (qc *failingCommitQueueCaller) commitOffsets(ctx context.Context, cInst consumerInstanceURI, offsets []PartitionOffset) error {
+	if !qc.failed {
+		qc.failed = true
+		return errors.New("commit failure")
+	}
+	return qc.scriptedQueueCaller.commitOffsets(ctx, cInst, offsets)
+}
+
+func TestFailedCommitKeepsOffsetsForShutdown(t *testing.T) {
+	queue := &failingCommitQueueCaller{scriptedQueueCaller: scriptedQueueCaller{fetches: [][]int{{0, 1}}}}
+	config := QueueConfig{CommitEvery: 1}
+	c := &consumerInstance{config: config, queue: queue, consumer: consInstTest, commits: newCommitScheduler(config),
+		processor: splitProcessor(func(m Message) {}), logger: log.NewUPPLogger("Test", "FATAL")}
+
+	_, err := c.consume()
+
+	assert.Error(t, err)
+	assert.Equal(t, [][]PartitionOffset{{{Topic: "test", Partition: 0, Offset: 1}}}, queue.commits,
+		"the offsets of the failed commit should be committed before the instance is destroyed")
+	assert.Empty(t, c.commits.offsets)
+}
+
+func TestCommitSchedulerDisabled(t *testing.T) {
+	assert.Nil(t, newCommitScheduler(QueueConfig{}))
+	assert.Nil(t, newCommitScheduler(QueueConfig{CommitEvery: 10, AutoCommitEnable: true}))
+}
+
+func TestOffsetsOfRevokedPartitionsAreNotCommitted(t *testing.T) {
+	queue := &assigningQueueCaller{
+		scriptedQueueCaller: scriptedQueueCaller{fetches: [][]int{{0}, {}}},
+		assigned:            [][]TopicPartition{{{Topic: "test", Partition: 0}}, {{Topic: "test", Partition: 1}}},
+	}
+	config := QueueConfig{CommitInterval: 60}
+	c := &consumerInstance{config: config, queue: queue, consumer: consInstTest, commits: newCommitScheduler(config),
+		processor: splitProcessor(func(m Message) {}), logger: log.NewUPPLogger("Test", "FATAL")}
+
+	_, err := c.consume()
+	assert.NoError(t, err)
+	assert.Equal(t, []PartitionOffset{{Topic: "test", Partition: 0, Offset: 0}}, c.commits.offsets)
+
+	c.assignCheck = time.Now().Add(-assignmentCheckInterval)
+	_, err = c.consume()
+	assert.NoError(t, err)
+	c.shutdown()
+	assert.Empty(t, queue.commits, "the offsets of the revoked partition should not overwrite the progress of its new owner")
+}
@@ -1,8 +1,11 @@
 package consumer
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"os"
 	"sync"
 
 	log "github.com/Financial-Times/go-logger/v2"
@@ -14,6 +17,12 @@ import (
 //
 // Stop method stops the consumption of messages.
 //
+// Pause suspends fetching of messages while keeping the consumer instances
+// alive on the proxy. Kafka evicts the instances from the consumer group once the pause exceeds
+// max.poll.interval.ms, 5 minutes by default, and their partitions are rebalanced until Resume is called.
+//
+// Resume continues fetching messages from the position where Pause left off.
+//
 // ConnectivityCheck implements the logic to check the current
 // connectivity to the queue.
 // The method should return a message about the status of the connection and
@@ -21,69 +30,180 @@ import (
 type MessageConsumer interface {
 	Start()
 	Stop()
+	Pause()
+	Resume()
 	ConnectivityCheck() (string, error)
 }
 
+// CircuitBreakerChecker is implemented by the consumers with handler circuit breakers.
+// CircuitBreakerCheck returns an error while any of the breakers is open or half-open.
+type CircuitBreakerChecker interface {
+	CircuitBreakerCheck() (string, error)
+}
+
+// LagChecker is implemented by the consumers monitoring the lag of the consumed partitions.
+// LagCheck returns an error when the lag of any partition exceeds the configured threshold.
+type LagChecker interface {
+	LagCheck() (string, error)
+}
+
 // NewConsumer returns a new instance of a Consumer
 func NewConsumer(config QueueConfig, handler func(m Message), client *http.Client, logger *log.UPPLogger) MessageConsumer {
-	streamCount := 1
-	if config.StreamCount > 0 {
-		streamCount = config.StreamCount
-	}
-	instanceHandlers := make([]instanceHandler, streamCount)
-	for i := 0; i < streamCount; i++ {
-		instanceHandlers[i] = newConsumerInstance(config, handler, client, logger)
-	}
+	return NewFallibleConsumer(config, func(m Message) error {
+		handler(m)
+		return nil
+	}, client, logger)
+}
 
-	return &Consumer{streamCount, instanceHandlers}
+// NewFallibleConsumer returns a new instance of a Consumer with a handler that can report failures.
+// The failures are counted by a circuit breaker which stops the consumption of new messages
+// after QueueConfig.CircuitBreakerThreshold consecutive failures.
+func NewFallibleConsumer(config QueueConfig, handler func(m Message) error, client *http.Client, logger *log.UPPLogger) MessageConsumer {
+	newQueue := queueCallers(config, client, nil)
+	return newStreamConsumer(config, func(config QueueConfig, limiter *rateLimiter) *consumerInstance {
+		return newConsumerInstance(config, handler, limiter, newQueue(config), newConfiguredValueDecoder(config, client), logger)
+	})
 }
 
 // NewBatchedConsumer returns a Consumer to manage batches of messages
 func NewBatchedConsumer(config QueueConfig, handler func(m []Message), client *http.Client, logger *log.UPPLogger) MessageConsumer {
-	streamCount := 1
-	if config.StreamCount > 0 {
-		streamCount = config.StreamCount
-	}
+	return NewFallibleBatchedConsumer(config, func(m []Message) error {
+		handler(m)
+		return nil
+	}, client, logger)
+}
 
-	instanceHandlers := make([]instanceHandler, streamCount)
-	for i := 0; i < streamCount; i++ {
-		instanceHandlers[i] = newBatchedConsumerInstance(config, handler, client, logger)
-	}
+// NewFallibleBatchedConsumer returns a Consumer to manage batches of messages with a handler that can report failures
+func NewFallibleBatchedConsumer(config QueueConfig, handler func(m []Message) error, client *http.Client, logger *log.UPPLogger) MessageConsumer {
+	newQueue := queueCallers(config, client, nil)
+	return newStreamConsumer(config, func(config QueueConfig, limiter *rateLimiter) *consumerInstance {
+		return newBatchedConsumerInstance(config, handler, limiter, newQueue(config), newConfiguredValueDecoder(config, client), logger)
+	})
+}
+
+// NewContextConsumer returns a new instance of a Consumer with a handler receiving a context.
+// The context carries the span of handling the message, started as a child of the span
+// in the traceparent header of the message.
+func NewContextConsumer(config QueueConfig, handler func(ctx context.Context, m Message) error, client *http.Client, logger *log.UPPLogger) MessageConsumer {
+	return NewFallibleConsumer(config, tracedHandler(newTracer(config), handler), client, logger)
+}
 
-	return &Consumer{streamCount, instanceHandlers}
+// NewBatchedContextConsumer returns a Consumer to manage batches of messages with a handler receiving a context.
+// The context carries the span of handling the batch, linked to the spans in the traceparent headers of the messages.
+func NewBatchedContextConsumer(config QueueConfig, handler func(ctx context.Context, m []Message) error, client *http.Client, logger *log.UPPLogger) MessageConsumer {
+	return NewFallibleBatchedConsumer(config, tracedBatchHandler(newTracer(config), handler), client, logger)
 }
 
-// NewAgeingConsumer returns a new instance of a Consumer with an AgeingClient
+// NewAgeingConsumer returns a new instance of a Consumer with an AgeingClient.
+// The connections are aged while the consumer is started.
 func NewAgeingConsumer(config QueueConfig, handler func(m Message), client *AgeingClient) MessageConsumer {
+	var agedClient *http.Client
+	newQueue := queueCallers(config, client.dialer(client.HTTPClient), func(hc *http.Client) *http.Client {
+		agedClient = hc
+		return client.client(hc)
+	})
+	c := newStreamConsumer(config, func(config QueueConfig, limiter *rateLimiter) *consumerInstance {
+		return newConsumerInstance(config, func(m Message) error {
+			handler(m)
+			return nil
+		}, limiter, newQueue(config), newConfiguredValueDecoder(config, client.HTTPClient), client.Logger)
+	})
+	c.ageing = client
+	c.agedClient = agedClient
+
+	return c
+}
+
+// newStreamConsumer returns a Consumer with an instance per stream.
+// The rate limiter, the worker pool, the recorder and the tracer are shared between the instances.
+func newStreamConsumer(config QueueConfig, newInstance func(config QueueConfig, limiter *rateLimiter) *consumerInstance) *Consumer {
+	if config.Prefetch {
+		// the proxy would auto-commit the prefetched records before they are processed
+		config.AutoCommitEnable = false
+	}
 	streamCount := 1
 	if config.StreamCount > 0 {
 		streamCount = config.StreamCount
 	}
+	limiter := newRateLimiter(config)
+	pool := newWorkerPool(config, streamCount)
+	recorder := newRecorder(config)
+	tracer := newTracer(config)
 	instanceHandlers := make([]instanceHandler, streamCount)
 	for i := 0; i < streamCount; i++ {
-		instanceHandlers[i] = newConsumerInstance(config, handler, client.HTTPClient, client.Logger)
+		if config.RateLimitPerStream {
+			limiter = newRateLimiter(config)
+		}
+		streamConfig := config
+		streamConfig.ConsumerProperties.Name = instanceName(config, i)
+		instance := newInstance(streamConfig, limiter)
+		instance.pool = pool
+		instance.recorder = recorder
+		instance.tracer = tracer
+		instance.lag = newLagMonitor(config)
+		instance.commits = newCommitScheduler(config)
+		instanceHandlers[i] = instance
 	}
-	client.StartAgeingProcess()
 
-	return &Consumer{streamCount, instanceHandlers}
+	return &Consumer{streamCount: streamCount, instanceHandlers: instanceHandlers, pool: pool, recorder: recorder}
+}
+
+// instanceName returns the name of the consumer instance of a stream.
+// Named instances are called after the configured name, the hostname and the stream index, so they are unique
+// to every stream of every replica and a restarted consumer can find and delete the instances left behind by its previous run.
+// Otherwise the configured name is suffixed with the stream index when there are several streams,
+// as the proxy rejects a second instance with the same name.
+func instanceName(config QueueConfig, stream int) string {
+	if !config.NamedInstances {
+		if config.ConsumerProperties.Name == "" || config.StreamCount <= 1 {
+			return config.ConsumerProperties.Name
+		}
+		return fmt.Sprintf("%s-%d", config.ConsumerProperties.Name, stream)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	if config.ConsumerProperties.Name == "" {
+		return fmt.Sprintf("%s-%d", hostname, stream)
+	}
+	return fmt.Sprintf("%s-%s-%d", config.ConsumerProperties.Name, hostname, stream)
 }
 
 type instanceHandler interface {
 	consumeWhileActive()
 	initiateShutdown()
 	shutdown()
+	pause()
+	resume()
 	checkConnectivity() error
+	checkCircuitBreaker() error
+	checkLag() error
+	partitionLags() []PartitionLag
+	inspectGroup() (groupCaller, bool)
 }
 
 // Consumer provides methods to consume messages from a kafka proxy
 type Consumer struct {
 	streamCount      int
 	instanceHandlers []instanceHandler
+	pool             *workerPool
+	recorder         *recorder
+	ageing           *AgeingClient
+	agedClient       *http.Client
 }
 
 //Start is a method that triggers the consumption of messages from the queue
 //Start is a blocking methode, it will return only when Stop() is called. If you don't want to block start it in a different goroutine.
 func (c *Consumer) Start() {
+	c.pool.start()
+	defer c.pool.stop()
+	if c.ageing != nil {
+		c.ageing.start(c.agedClient)
+		defer c.ageing.stop(c.agedClient)
+	}
+	defer c.recorder.close()
+
 	var wg sync.WaitGroup
 	wg.Add(c.streamCount)
 	for _, ih := range c.instanceHandlers {
@@ -102,6 +222,20 @@ func (c *Consumer) Stop() {
 	}
 }
 
+//Pause is a method to suspend the consumption of messages without destroying the consumer instances
+func (c *Consumer) Pause() {
+	for _, ih := range c.instanceHandlers {
+		ih.pause()
+	}
+}
+
+//Resume is a method to continue the consumption of messages after Pause() was called
+func (c *Consumer) Resume() {
+	for _, ih := range c.instanceHandlers {
+		ih.resume()
+	}
+}
+
 //ConnectivityCheck returns the connection status with the kafka proxy
 func (c *Consumer) ConnectivityCheck() (string, error) {
 	errMsg := ""
@@ -116,3 +250,85 @@ func (c *Consumer) ConnectivityCheck() (string, error) {
 
 	return "Error connecting to consumer proxies", errors.New(errMsg)
 }
+
+// checkReachable returns an error if none of the proxies of the consumer is reachable
+func (c *Consumer) checkReachable() error {
+	for _, ih := range c.instanceHandlers {
+		if r, ok := ih.(reachabilityChecker); ok {
+			// the streams share the proxies
+			return r.checkReachable()
+		}
+	}
+	_, err := c.ConnectivityCheck()
+	return err
+}
+
+//CircuitBreakerCheck returns the state of the handler circuit breakers
+func (c *Consumer) CircuitBreakerCheck() (string, error) {
+	errMsg := ""
+	for _, ih := range c.instanceHandlers {
+		if err := ih.checkCircuitBreaker(); err != nil {
+			errMsg = errMsg + err.Error()
+		}
+	}
+	if errMsg == "" {
+		return "Message handler circuit breakers are closed.", nil
+	}
+
+	return "Message handler is failing", errors.New(errMsg)
+}
+
+//LagCheck returns the lag of the consumed partitions, failing when it exceeds the threshold
+func (c *Consumer) LagCheck() (string, error) {
+	errMsg := ""
+	for _, ih := range c.instanceHandlers {
+		if err := ih.checkLag(); err != nil {
+			errMsg = errMsg + err.Error()
+		}
+	}
+	if errMsg == "" {
+		var total int64
+		for _, l := range c.Lag() {
+			total += l.Lag
+		}
+		return fmt.Sprintf("Consumer lag is within threshold, %d records behind.", total), nil
+	}
+
+	return "Consumer is lagging behind", errors.New(errMsg)
+}
+
+//ConsumerGroup returns the state of the consumer group. It requires APIVersion v3.
+func (c *Consumer) ConsumerGroup() (ConsumerGroup, error) {
+	q, err := c.groupCaller()
+	if err != nil {
+		return ConsumerGroup{}, err
+	}
+	return q.consumerGroup()
+}
+
+//GroupConsumers returns the members of the consumer group, including the instances of other consumers. It requires APIVersion v3.
+func (c *Consumer) GroupConsumers() ([]GroupConsumer, error) {
+	q, err := c.groupCaller()
+	if err != nil {
+		return nil, err
+	}
+	return q.groupConsumers()
+}
+
+func (c *Consumer) groupCaller() (groupCaller, error) {
+	for _, ih := range c.instanceHandlers {
+		if q, ok := ih.inspectGroup(); ok {
+			return q, nil
+		}
+	}
+	return nil, ErrNoGroupInspection
+}
+
+//Lag returns the last measured lag of the partitions assigned to the consumer instances
+func (c *Consumer) Lag() []PartitionLag {
+	var lags []PartitionLag
+	for _, ih := range c.instanceHandlers {
+		lags = append(lags, ih.partitionLags()...)
+	}
+	return lags
+}
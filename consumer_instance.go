@@ -1,16 +1,26 @@
 package consumer
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
-	"sync"
+	"runtime/debug"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	log "github.com/Financial-Times/go-logger/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 const (
 	defaultBackoffPeriod = 8
 	defaultOffsetReset   = "latest"
+	// default max.poll.interval.ms of the Kafka consumers
+	defaultMaxPollInterval = 5 * time.Minute
 )
 
 var offsetResetOptions = map[string]bool{
@@ -20,51 +30,142 @@ var offsetResetOptions = map[string]bool{
 }
 
 // newConsumerInstance returns a new instance of consumerInstance
-func newConsumerInstance(config QueueConfig, handler func(m Message), client *http.Client, logger *log.UPPLogger) *consumerInstance {
-	offset := defaultOffsetReset
-	if offsetResetOptions[config.Offset] {
-		offset = config.Offset
-	}
-	queue := &kafkaRESTClient{
-		addrs:            config.Addrs,
-		group:            config.Group,
-		topic:            config.Topic,
-		offset:           offset,
-		autoCommitEnable: config.AutoCommitEnable,
-		caller:           httpClient{config.Queue, config.AuthorizationKey, client},
-	}
-	return &consumerInstance{
+func newConsumerInstance(config QueueConfig, handler func(m Message) error, limiter *rateLimiter, queue queueCaller, decode valueDecoder, logger *log.UPPLogger) *consumerInstance {
+	guard := newPanicGuard(config, logger)
+	breaker := newCircuitBreaker(config, func(msgs []delivery) error {
+		limiter.wait(1)
+		return guard.run(msgs, func() error { return handler(msgs[0].Message) })
+	}, logger)
+	c := &consumerInstance{
 		config:       config,
 		queue:        queue,
 		consumer:     nil,
 		shutdownChan: make(chan bool, 1),
-		processor:    splitMessageProcessor{handler},
+		processor:    breakerProcessor{breaker: breaker},
+		decode:       decode,
+		breaker:      breaker,
+		guard:        guard,
 		logger:       logger,
 	}
+	guard.backOff = func() { c.backOff(c.backoffPeriod()) }
+	return c
 }
 
 // newBatchedConsumerInstance returns a new instance of a QueueConsumer that handles batches of messages
-func newBatchedConsumerInstance(config QueueConfig, handler func(m []Message), client *http.Client, logger *log.UPPLogger) *consumerInstance {
+func newBatchedConsumerInstance(config QueueConfig, handler func(m []Message) error, limiter *rateLimiter, queue queueCaller, decode valueDecoder, logger *log.UPPLogger) *consumerInstance {
+	return newDeliveryConsumerInstance(config, func(msgs []delivery) error {
+		return handler(messagesOf(msgs))
+	}, limiter, queue, decode, logger)
+}
+
+// newDeliveryConsumerInstance returns a new instance of a QueueConsumer that handles batches of messages
+// with the positions of their records
+func newDeliveryConsumerInstance(config QueueConfig, handler func(msgs []delivery) error, limiter *rateLimiter, queue queueCaller, decode valueDecoder, logger *log.UPPLogger) *consumerInstance {
+	guard := newPanicGuard(config, logger)
+	breaker := newCircuitBreaker(config, func(msgs []delivery) error {
+		limiter.wait(len(msgs))
+		return guard.run(msgs, func() error { return handler(msgs) })
+	}, logger)
+	c := &consumerInstance{
+		config:       config,
+		queue:        queue,
+		consumer:     nil,
+		shutdownChan: make(chan bool, 1),
+		processor:    breakerProcessor{breaker: breaker, batched: true},
+		batched:      true,
+		decode:       decode,
+		breaker:      breaker,
+		guard:        guard,
+		logger:       logger,
+	}
+	guard.backOff = func() { c.backOff(c.backoffPeriod()) }
+	return c
+}
+
+// queueCallers returns the constructor of the queue callers of the streams of a consumer.
+// The streams share the proxy health and the TLS connections, wrapped by wrap if set.
+// An invalid TLS config is returned by every call of the queue callers, without sending requests.
+func queueCallers(config QueueConfig, client *http.Client, wrap func(*http.Client) *http.Client) func(config QueueConfig) queueCaller {
+	health := newProxyHealth(config)
+	tlsClient, err := withTLS(config, client)
+	if err == nil && wrap != nil {
+		tlsClient = wrap(tlsClient)
+	}
+	return func(config QueueConfig) queueCaller {
+		if err != nil {
+			return configErrorCaller{err}
+		}
+		return newQueueCaller(config, tlsClient, health)
+	}
+}
+
+// newQueueCaller returns the client of the configured REST proxy API version
+func newQueueCaller(config QueueConfig, client *http.Client, health *proxyHealth) queueCaller {
+	q := newKafkaRESTClient(config, client)
+	q.health = health
+	if config.APIVersion == APIv3 {
+		return newKafkaRESTv3Client(q, config.ClusterID)
+	}
+	return q
+}
+
+// configErrorCaller fails every call with the error of the consumer config
+type configErrorCaller struct {
+	err error
+}
+
+func (q configErrorCaller) createConsumerInstance() (consumerInstanceURI, error) {
+	return consumerInstanceURI{}, q.err
+}
+
+func (q configErrorCaller) destroyConsumerInstance(consumerInstanceURI) error {
+	return q.err
+}
+
+func (q configErrorCaller) subscribeConsumerInstance(consumerInstanceURI) error {
+	return q.err
+}
+
+func (q configErrorCaller) destroyConsumerInstanceSubscription(consumerInstanceURI) error {
+	return q.err
+}
+
+func (q configErrorCaller) keepAliveConsumerInstance(consumerInstanceURI) error {
+	return q.err
+}
+
+func (q configErrorCaller) consumeMessages(context.Context, consumerInstanceURI) ([]Record, error) {
+	return nil, q.err
+}
+
+func (q configErrorCaller) commitOffsets(context.Context, consumerInstanceURI, []PartitionOffset) error {
+	return q.err
+}
+
+func (q configErrorCaller) checkConnectivity() error {
+	return q.err
+}
+
+func newKafkaRESTClient(config QueueConfig, client *http.Client) *kafkaRESTClient {
 	offset := defaultOffsetReset
 	if offsetResetOptions[config.Offset] {
 		offset = config.Offset
 	}
-	queue := &kafkaRESTClient{
+	properties := config.ConsumerProperties
+	if !embeddedFormats[properties.Format] {
+		properties.Format = ""
+	}
+	return &kafkaRESTClient{
 		addrs:            config.Addrs,
 		group:            config.Group,
 		topic:            config.Topic,
 		offset:           offset,
 		autoCommitEnable: config.AutoCommitEnable,
-		caller:           httpClient{config.Queue, config.AuthorizationKey, client},
-	}
-
-	return &consumerInstance{
-		config:       config,
-		queue:        queue,
-		consumer:     nil,
-		shutdownChan: make(chan bool, 1),
-		processor:    batchedMessageProcessor{handler},
-		logger:       logger,
+		properties:       properties,
+		namedInstances:   config.NamedInstances,
+		fetchTimeout:     config.FetchTimeout,
+		fetchMaxBytes:    config.FetchMaxBytes,
+		caller:           httpClient{config.Queue, credentials(config), client},
 	}
 }
 
@@ -73,13 +174,14 @@ type queueCaller interface {
 	destroyConsumerInstance(c consumerInstanceURI) error
 	subscribeConsumerInstance(c consumerInstanceURI) error
 	destroyConsumerInstanceSubscription(c consumerInstanceURI) error
-	consumeMessages(c consumerInstanceURI) ([]byte, error)
-	commitOffsets(c consumerInstanceURI) error
+	keepAliveConsumerInstance(c consumerInstanceURI) error
+	consumeMessages(ctx context.Context, c consumerInstanceURI) ([]Record, error)
+	commitOffsets(ctx context.Context, c consumerInstanceURI, offsets []PartitionOffset) error
 	checkConnectivity() error
 }
 
 type messageProcessor interface {
-	consume(messages ...Message)
+	consume(messages ...delivery)
 }
 
 //consumerInstance is the default implementation of the QueueConsumer interface.
@@ -90,42 +192,129 @@ type consumerInstance struct {
 	consumer     *consumerInstanceURI
 	shutdownChan chan bool
 	processor    messageProcessor
+	decode       valueDecoder
+	breaker      *circuitBreaker
+	guard        *panicGuard
+	pool         *workerPool
+	recorder     *recorder
+	prefetcher   *prefetcher
+	prefetched   []fetchResult
+	tracer       trace.Tracer
+	lag          *lagMonitor
+	partitions   map[TopicPartition]bool
+	assignCheck  time.Time
+	uncommitted  []PartitionOffset
+	carried      batch
+	commits      *commitScheduler
 	logger       *log.UPPLogger
+	batched      bool
+	paused       atomic.Bool
+	pausedSince  time.Time
 }
 
 func (c *consumerInstance) consumeWhileActive() {
 	for {
 		select {
 		case <-c.shutdownChan:
+			instance := c.instanceID()
 			c.shutdown()
+			c.observer().ShutDown(instance)
 			return
 		default:
-			c.consumeAndHandleMessages()
+			if c.paused.Load() {
+				c.stopPrefetching()
+				c.keepAlive()
+			} else {
+				c.pausedSince = time.Time{}
+				c.consumeAndHandleMessages()
+			}
+			c.measureLag()
+			if c.guard.stopping() {
+				c.observer().ShutDown("")
+				return
+			}
 		}
 	}
 }
 
+// keepAlive issues a lightweight request against the consumer instance while consumption is paused,
+// so the proxy does not expire the instance. The request does not poll Kafka, so the group still evicts
+// the member once the pause exceeds max.poll.interval.ms, which is logged once per pause.
+func (c *consumerInstance) keepAlive() {
+	if c.pausedSince.IsZero() {
+		c.pausedSince = time.Now()
+	}
+	if paused, limit := time.Since(c.pausedSince), c.maxPollInterval(); paused >= limit && paused-c.backoffPeriod() < limit {
+		c.logger.Warnf("Consumption paused for longer than max.poll.interval.ms (%s), the partitions are rebalanced to the other members of the group until it is resumed", limit)
+	}
+	if c.consumer != nil {
+		if err := c.queue.keepAliveConsumerInstance(*c.consumer); err != nil {
+			c.logger.WithError(err).Error("Error keeping paused consumer instance alive")
+
+			c.shutdown()
+		}
+	}
+	time.Sleep(c.backoffPeriod())
+}
+
+// maxPollInterval returns the max.poll.interval.ms of the consumer instances, after which Kafka evicts
+// a member which did not poll
+func (c *consumerInstance) maxPollInterval() time.Duration {
+	if ms, err := strconv.Atoi(c.config.ConsumerProperties.Extra["max.poll.interval.ms"]); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return defaultMaxPollInterval
+}
+
+func (c *consumerInstance) backoffPeriod() time.Duration {
+	backoffPeriod := defaultBackoffPeriod
+	if c.config.BackoffPeriod > 0 {
+		backoffPeriod = c.config.BackoffPeriod
+	}
+	return time.Duration(backoffPeriod) * time.Second
+}
+
+// emptyPollBackoffPeriod returns the period to wait after a poll returned no messages.
+// With long polling the proxy already waited for the fetch timeout, so there is no need to wait more.
+func (c *consumerInstance) emptyPollBackoffPeriod() time.Duration {
+	if c.config.FetchTimeout > 0 && (c.breaker == nil || c.breaker.closed()) {
+		return 0
+	}
+	return c.backoffPeriod()
+}
+
 func (c *consumerInstance) consumeAndHandleMessages() {
 	defer func() {
 		if r := recover(); r != nil {
 			err, ok := r.(error)
 			if !ok {
-				c.logger.WithError(err).Error("Recovered from panic")
+				err = fmt.Errorf("%v", r)
 			}
+			c.logger.WithError(err).WithField("stack", string(debug.Stack())).Error("Recovered from panic")
+			c.observer().PanicRecovered(c.instanceID(), r)
 		}
 	}()
-	backoffPeriod := defaultBackoffPeriod
-	if c.config.BackoffPeriod > 0 {
-		backoffPeriod = c.config.BackoffPeriod
+	msgs, err := c.consume()
+	if c.guard.stopping() {
+		return
 	}
+	if err != nil {
+		c.backOff(c.backoffPeriod())
+	} else if len(msgs) == 0 {
+		c.backOff(c.emptyPollBackoffPeriod())
+	}
+}
 
-	msgs, err := c.consume()
-	if err != nil || len(msgs) == 0 {
-		time.Sleep(time.Duration(backoffPeriod) * time.Second)
+// backOff waits for the period, notifying the observer unless there is nothing to wait for
+func (c *consumerInstance) backOff(period time.Duration) {
+	if period <= 0 {
+		return
 	}
+	c.observer().BackingOff(c.instanceID(), period)
+	time.Sleep(period)
 }
 
-func (c *consumerInstance) consume() ([]Message, error) {
+func (c *consumerInstance) consume() ([]delivery, error) {
 	q := c.queue
 	if c.consumer == nil {
 		cInst, err := q.createConsumerInstance()
@@ -134,6 +323,8 @@ func (c *consumerInstance) consume() ([]Message, error) {
 			return nil, err
 		}
 		c.consumer = &cInst
+		c.guard.reset()
+		c.observer().InstanceCreated(cInst.BaseURI)
 
 		err = q.subscribeConsumerInstance(*c.consumer)
 		if err != nil {
@@ -142,88 +333,328 @@ func (c *consumerInstance) consume() ([]Message, error) {
 			c.shutdown()
 			return nil, err
 		}
+		c.observer().Subscribed(cInst.BaseURI, c.config.Topic)
 	}
 
-	res, err := q.consumeMessages(*c.consumer)
-	if err != nil {
-		c.logger.WithError(err).Error("Error consuming messages")
+	var msgs []delivery
+	if c.breaker != nil && !c.breaker.closed() {
+		c.stopPrefetching()
+		var ok bool
+		msgs, ok = c.probeHandler()
+		if !ok {
+			return nil, nil
+		}
+	} else if c.breaker != nil && c.breaker.hasPending() {
+		// the messages which failed below the threshold are handled again before new ones are fetched
+		msgs = c.breaker.takePending()
+	} else {
+		b, err := c.fetch()
+		if err != nil {
+			return nil, err
+		}
+		msgs = b.msgs
+	}
 
-		c.shutdown()
-		return nil, err
+	if c.pool != nil {
+		c.pool.process(msgs, func(m delivery) {
+			c.processor.consume(m)
+		})
+	} else {
+		c.processor.consume(msgs...)
 	}
-	msgs, err := parseResponse(res, c.logger)
-	if err != nil {
-		c.logger.WithError(err).Error("Error parsing messages")
+
+	if c.guard.stopping() {
+		err := errors.New("message handler panic stopped the consumption")
+		c.logger.WithError(err).Error("Stopping consumer instance without committing offsets")
 
 		c.shutdown()
 		return nil, err
 	}
 
-	if c.config.ConcurrentProcessing {
-		processors := 100
-		if c.config.NoOfProcessors > 0 {
-			processors = c.config.NoOfProcessors
+	if c.breaker != nil && c.breaker.hasPending() {
+		// the pending messages must be redelivered if the consumer instance gets recreated
+		return msgs, nil
+	}
+
+	if c.commits != nil {
+		c.commits.add(c.uncommitted, len(msgs))
+		c.uncommitted = nil
+		if !c.commits.due() {
+			return msgs, nil
 		}
-		rwWg := sync.WaitGroup{}
-		ch := make(chan Message, 128)
+		if err := c.commitScheduled(); err != nil {
+			c.logger.WithError(err).Error("Error committing offsets")
+			c.observer().CommitFailed(c.instanceID(), err)
 
-		rwWg.Add(1)
-		go func() {
-			for _, msg := range msgs {
-				ch <- msg
-			}
-			close(ch)
-			rwWg.Done()
-		}()
+			c.shutdown()
+			return nil, err
+		}
+	} else if !c.config.AutoCommitEnable {
+		err := c.commit()
+		if err != nil {
+			c.logger.WithError(err).Error("Error committing offsets")
+			c.observer().CommitFailed(c.instanceID(), err)
 
-		for i := 0; i < processors; i++ {
-			rwWg.Add(1)
-			go func() {
-				for m := range ch {
-					c.processor.consume(m)
-				}
+			c.shutdown()
+			return nil, err
+		}
+	}
+	c.uncommitted = nil
+
+	return msgs, nil
+}
 
-				rwWg.Done()
-			}()
+// commit commits the offsets of the processed messages.
+// When prefetching or accumulating batches, the consumer instance may have already fetched messages which
+// are not processed yet, so only the offsets of the processed batches are committed explicitly.
+func (c *consumerInstance) commit() (err error) {
+	if !c.config.Prefetch && !c.accumulates() {
+		ctx, span := c.startSpan(context.Background(), "commit")
+		defer func() { endSpan(span, err) }()
+		if err := c.queue.commitOffsets(ctx, *c.consumer, nil); err != nil {
+			return err
 		}
-		rwWg.Wait()
+		c.observer().Committed(c.instanceID(), nil)
+		return nil
+	}
+	if len(c.uncommitted) == 0 {
+		return nil
+	}
+	ctx, span := c.startSpan(context.Background(), "commit", attribute.Int("messaging.kafka.partition_count", len(c.uncommitted)))
+	defer func() { endSpan(span, err) }()
+	if err := c.queue.commitOffsets(ctx, *c.consumer, c.uncommitted); err != nil {
+		return err
+	}
+	c.observer().Committed(c.instanceID(), c.uncommitted)
+	return nil
+}
+
+// startSpan starts a span of the consumer instance. Fetching and committing are not part of the traces of
+// the messages, as a request covers many messages, so their spans are started without a parent.
+func (c *consumerInstance) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := c.tracer
+	if tracer == nil {
+		tracer = noop.NewTracerProvider().Tracer(tracerName)
+	}
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
 
+// fetch returns the next batch of messages, either directly from the queue or from the prefetcher.
+// The offsets of the batch are added to the offsets to be committed.
+func (c *consumerInstance) fetch() (batch, error) {
+	var b batch
+	var err error
+	if c.accumulates() {
+		b, err = c.accumulate()
 	} else {
-		c.processor.consume(msgs...)
+		b, err = c.nextBatch(time.Time{})
+	}
+	if err != nil {
+		c.logger.WithError(err).Error("Error consuming messages")
+		c.observer().FetchFailed(c.instanceID(), err)
+
+		c.shutdown()
+		return batch{}, err
+	}
+
+	c.observeAssignments(b.offsets)
+	if len(b.msgs) > 0 {
+		c.observer().Fetched(c.instanceID(), len(b.msgs))
+	} else {
+		c.observer().EmptyPoll(c.instanceID())
+	}
+	c.uncommitted = mergeOffsets(c.uncommitted, b.offsets...)
+	return b, nil
+}
+
+// nextBatch returns the next batch, either directly from the queue or from the prefetcher.
+// Batches prefetched before the prefetcher was stopped are returned first. While the circuit breaker
+// is not closed, batches are only fetched on demand.
+// A non-zero deadline caps the long polls, and the wait for a prefetched batch, which then returns an empty batch.
+func (c *consumerInstance) nextBatch(deadline time.Time) (batch, error) {
+	if len(c.prefetched) > 0 {
+		r := c.prefetched[0]
+		c.prefetched = c.prefetched[1:]
+		return r.batch, r.err
+	}
+	if !c.config.Prefetch || (c.breaker != nil && !c.breaker.closed()) {
+		return c.fetchBatch(deadline)
+	}
+	if c.prefetcher == nil {
+		c.prefetcher = startPrefetcher(func() (batch, error) { return c.fetchBatch(time.Time{}) }, c.config.PrefetchBuffer)
+	}
+	return c.prefetcher.next(deadline)
+}
+
+// stopPrefetching stops fetching in the background while the consumption is paused or the circuit breaker is not closed.
+// The batches fetched already are kept for when the consumption continues.
+func (c *consumerInstance) stopPrefetching() {
+	if c.prefetcher != nil {
+		c.prefetched = append(c.prefetched, c.prefetcher.stop()...)
+		c.prefetcher = nil
 	}
+}
 
-	if !c.config.AutoCommitEnable {
-		err = q.commitOffsets(*c.consumer)
+// fetchBatch requests records until at least MinBatchSize messages are fetched or a request returns no records.
+// A non-zero deadline caps the timeout of the requests, and no more requests are made once it has passed.
+func (c *consumerInstance) fetchBatch(deadline time.Time) (batch, error) {
+	consumer := *c.consumer
+	base := context.Background()
+	if !deadline.IsZero() {
+		base = withFetchTimeout(base, deadline)
+	}
+	var b batch
+	for {
+		ctx, span := c.startSpan(base, "fetch")
+		records, err := c.queue.consumeMessages(ctx, consumer)
 		if err != nil {
-			c.logger.WithError(err).Error("Error committing offsets")
+			endSpan(span, err)
+			return batch{}, err
+		}
+		span.SetAttributes(attribute.Int("messaging.batch.message_count", len(records)))
+		if err := c.recorder.record(records); err != nil {
+			c.logger.WithError(err).Error("Error recording fetched records")
+		}
+		decode := c.decode
+		if decode == nil {
+			decode = decodeBinaryValue
+		}
+		_, parseSpan := c.startSpan(ctx, "parse")
+		fetched, err := decodeRecords(records, decode, c.logger)
+		endSpan(parseSpan, err)
+		if err != nil {
+			endSpan(span, err)
+			return batch{}, err
+		}
+		span.End()
+		b.msgs = append(b.msgs, fetched.msgs...)
+		b.offsets = mergeOffsets(b.offsets, fetched.offsets...)
+
+		if len(b.msgs) >= c.config.MinBatchSize || len(fetched.offsets) == 0 || (!deadline.IsZero() && !time.Now().Before(deadline)) {
+			return b, nil
+		}
+	}
+}
+
+// probeHandler is used while the circuit breaker is not closed. During the cool-down period it only keeps
+// the consumer instance alive. Afterwards it probes the handler with a single pending message, fetching one
+// batch if there are no pending messages. It returns the remaining pending messages once the probe succeeded.
+func (c *consumerInstance) probeHandler() ([]delivery, bool) {
+	if c.breaker.coolingDown() {
+		if err := c.queue.keepAliveConsumerInstance(*c.consumer); err != nil {
+			c.logger.WithError(err).Error("Error keeping consumer instance alive while circuit breaker is open")
 
 			c.shutdown()
-			return nil, err
 		}
+		return nil, false
 	}
 
-	return msgs, nil
+	if !c.breaker.hasPending() {
+		b, err := c.fetch()
+		if err != nil {
+			return nil, false
+		}
+		c.breaker.hold(b.msgs)
+	}
+	return c.breaker.probe()
 }
 
 func (c *consumerInstance) shutdown() {
+	if c.prefetcher != nil {
+		// the prefetched records are redelivered to the next consumer instance
+		c.prefetcher.stop()
+		c.prefetcher = nil
+	}
+	c.prefetched = nil
+	c.commitOnShutdown()
+	// the offsets which could not be committed are redelivered to the next consumer instance
+	c.commits.reset()
+	c.uncommitted = nil
+	c.carried = batch{}
+	c.partitions = nil
+	c.assignCheck = time.Time{}
 	if c.consumer != nil {
 		err := c.queue.destroyConsumerInstanceSubscription(*c.consumer)
 		if err != nil {
 			c.logger.WithError(err).Error("Error deleting consumer instance subscription")
+		} else {
+			c.observer().Unsubscribed(c.consumer.BaseURI, c.config.Topic)
 		}
 		err = c.queue.destroyConsumerInstance(*c.consumer)
 		if err != nil {
 			c.logger.WithError(err).Error("Error deleting consumer instance")
+		} else {
+			c.observer().InstanceDestroyed(c.consumer.BaseURI)
 		}
 
+		c.lag.update(*c.consumer, nil)
 		c.consumer = nil
 	}
+	if c.breaker != nil {
+		c.breaker.dropPending()
+	}
 }
 
 func (c *consumerInstance) initiateShutdown() {
 	c.shutdownChan <- true
 }
 
+func (c *consumerInstance) pause() {
+	c.paused.Store(true)
+}
+
+func (c *consumerInstance) resume() {
+	c.paused.Store(false)
+}
+
+func (c *consumerInstance) checkCircuitBreaker() error {
+	if c.breaker == nil {
+		return nil
+	}
+	return c.breaker.check()
+}
+
+// measureLag measures the lag of the partitions assigned to the consumer instance when it is due
+func (c *consumerInstance) measureLag() {
+	if c.consumer == nil || !c.lag.due() {
+		return
+	}
+	q, ok := c.queue.(lagCaller)
+	if !ok {
+		return
+	}
+	lags, err := q.partitionLags(*c.consumer)
+	if err != nil {
+		c.logger.WithError(err).Warn("Error measuring consumer lag")
+		return
+	}
+	c.lag.update(*c.consumer, lags)
+}
+
+func (c *consumerInstance) inspectGroup() (groupCaller, bool) {
+	q, ok := c.queue.(groupCaller)
+	return q, ok
+}
+
+func (c *consumerInstance) checkLag() error {
+	return c.lag.check()
+}
+
+func (c *consumerInstance) partitionLags() []PartitionLag {
+	return c.lag.current()
+}
+
+// checkReachable returns an error if none of the proxies is reachable, for the queue callers which can tell
+func (c *consumerInstance) checkReachable() error {
+	if q, ok := c.queue.(reachabilityChecker); ok {
+		return q.checkReachable()
+	}
+	return c.queue.checkConnectivity()
+}
+
 func (c *consumerInstance) checkConnectivity() error {
+	if c.guard.stopping() {
+		return errors.New("consumption stopped by a message handler panic; ")
+	}
 	return c.queue.checkConnectivity()
 }
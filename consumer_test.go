@@ -1,10 +1,14 @@
 package consumer
 
 import (
+	"context"
 	"errors"
+	"os"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	log "github.com/Financial-Times/go-logger/v2"
 	"github.com/stretchr/testify/assert"
@@ -22,27 +26,28 @@ func TestConsume(t *testing.T) {
 		{
 			consumer: &consumerInstance{
 				config: QueueConfig{}, queue: defaultTestQueueCaller{}, consumer: consInstTest,
-				processor: splitMessageProcessor{func(m Message) {}}, logger: logger},
+				processor: splitProcessor(func(m Message) {}), logger: logger},
 			expMsgs: msgsTest,
 			expCons: consInstTest,
 		},
 		{
 			consumer: &consumerInstance{
 				config: QueueConfig{}, queue: defaultTestQueueCaller{},
-				processor: splitMessageProcessor{func(m Message) {}}, logger: logger},
+				processor: splitProcessor(func(m Message) {}), logger: logger},
 			expMsgs: msgsTest,
 			expCons: consInstTest,
 		},
 		{
 			consumer: &consumerInstance{
 				config: QueueConfig{}, queue: consumeMsgErrorQueueCaller{}, consumer: consInstTest,
-				processor: splitMessageProcessor{func(m Message) {}}, logger: logger},
+				processor: splitProcessor(func(m Message) {}), logger: logger},
 			expErr: errors.New("error while consuming"),
 		},
 	}
 
 	for _, test := range tests {
-		actMsgs, actErr := test.consumer.consume()
+		actDeliveries, actErr := test.consumer.consume()
+		actMsgs := messagesOf(actDeliveries)
 		if !reflect.DeepEqual(actMsgs, test.expMsgs) || !reflect.DeepEqual(test.consumer.consumer, test.expCons) || !reflect.DeepEqual(test.expErr, actErr) {
 			t.Errorf("Expected: msgs: %v, error: %v, consumer: %v\nActual: msgs: %v, error: %v consumer: %v.",
 				test.expMsgs, test.expErr, test.expCons, actMsgs, actErr, test.consumer.consumer)
@@ -54,25 +59,25 @@ func TestBatchConsumer(t *testing.T) {
 	consumer := &consumerInstance{
 		config:   QueueConfig{},
 		queue:    defaultTestQueueCaller{},
-		consumer: consInstTest, processor: batchedMessageProcessor{func(m []Message) {
+		consumer: consInstTest, processor: batchedProcessor(func(m []Message) {
 			assert.Equal(t, msgsTest, m)
-		}},
+		}),
 		logger: log.NewUPPLogger("Test", "FATAL"),
 	}
 
 	msgs, err := consumer.consume()
 	assert.Nil(t, err)
-	assert.Equal(t, msgsTest, msgs)
+	assert.Equal(t, msgsTest, messagesOf(msgs))
 }
 
 func TestConsumeAndHandleMessagesRecoversFromPanic(t *testing.T) {
-	c := consumerInstance{config: QueueConfig{BackoffPeriod: 1}, queue: consumeMsgPanicQueueCaller{}, processor: splitMessageProcessor{func(m Message) {}}}
+	c := consumerInstance{config: QueueConfig{BackoffPeriod: 1}, queue: consumeMsgPanicQueueCaller{}, processor: splitProcessor(func(m Message) {}), logger: log.NewUPPLogger("Test", "FATAL")}
 	c.consumeAndHandleMessages()
 }
 
 func TestConsumeWhileActiveTerminates(t *testing.T) {
 	sdChan := make(chan bool)
-	c := consumerInstance{config: QueueConfig{}, queue: defaultTestQueueCaller{}, shutdownChan: sdChan, processor: splitMessageProcessor{func(m Message) {}}}
+	c := consumerInstance{config: QueueConfig{}, queue: defaultTestQueueCaller{}, shutdownChan: sdChan, processor: splitProcessor(func(m Message) {})}
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
@@ -86,9 +91,9 @@ func TestConsumeWhileActiveTerminates(t *testing.T) {
 func TestStartStop(t *testing.T) {
 	consumers := make([]instanceHandler, 2)
 	for i := 0; i < 2; i++ {
-		consumers[i] = &consumerInstance{config: QueueConfig{}, queue: defaultTestQueueCaller{}, shutdownChan: make(chan bool), processor: splitMessageProcessor{func(m Message) {}}}
+		consumers[i] = &consumerInstance{config: QueueConfig{}, queue: defaultTestQueueCaller{}, shutdownChan: make(chan bool), processor: splitProcessor(func(m Message) {})}
 	}
-	c := Consumer{2, consumers}
+	c := Consumer{streamCount: 2, instanceHandlers: consumers}
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -101,9 +106,45 @@ func TestStartStop(t *testing.T) {
 	wg.Wait()
 }
 
+func TestPausedConsumerKeepsInstanceAlive(t *testing.T) {
+	queue := &countingTestQueueCaller{}
+	c := &consumerInstance{config: QueueConfig{BackoffPeriod: 1}, queue: queue, consumer: consInstTest,
+		processor: splitProcessor(func(m Message) {}), logger: log.NewUPPLogger("Test", "FATAL")}
+
+	c.pause()
+	c.keepAlive()
+	assert.Equal(t, int32(1), queue.keepAlives.Load())
+	assert.Equal(t, int32(0), queue.fetches.Load())
+	assert.Equal(t, consInstTest, c.consumer, "the paused consumer instance should not be destroyed")
+
+	c.resume()
+	msgs, err := c.consume()
+	assert.NoError(t, err)
+	assert.Equal(t, msgsTest, messagesOf(msgs))
+	assert.Equal(t, int32(1), queue.fetches.Load())
+}
+
+func TestPausedConsumerTerminates(t *testing.T) {
+	sdChan := make(chan bool, 1)
+	c := &consumerInstance{config: QueueConfig{BackoffPeriod: 1}, queue: &countingTestQueueCaller{}, consumer: consInstTest, shutdownChan: sdChan,
+		processor: splitProcessor(func(m Message) {}), logger: log.NewUPPLogger("Test", "FATAL")}
+	c.pause()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		c.consumeWhileActive()
+		wg.Done()
+	}()
+	c.initiateShutdown()
+	wg.Wait()
+	assert.Nil(t, c.consumer)
+}
+
 var consInstTest = &consumerInstanceURI{"/queue/consumergroup/instance-d"}
 var msgsTestByteA = []byte(`[{"value":"RlRNU0cvMS4wCgpib2R5Cg==","partition":0,"offset":0},{"value":"TWVzc2FnZS1JZDogMDAwMC0xMTExLTAwMDAtYWJjZAoKW10K","partition":0,"offset":1}]`)
 var msgsTest = []Message{{nil, "body"}, {map[string]string{"Message-Id": "0000-1111-0000-abcd"}, "[]"}}
+var deliveriesTest = []delivery{{msgsTest[0], PartitionOffset{"test", 0, 0}}, {msgsTest[1], PartitionOffset{"test", 0, 1}}}
 
 //test queueCaller implementations
 
@@ -136,14 +177,21 @@ func (qc defaultTestQueueCaller) destroyConsumerInstanceSubscription(cInst consu
 	return nil
 }
 
-func (qc defaultTestQueueCaller) consumeMessages(cInst consumerInstanceURI) ([]byte, error) {
+func (qc defaultTestQueueCaller) keepAliveConsumerInstance(cInst consumerInstanceURI) error {
+	if len(cInst.BaseURI) == 0 {
+		return errors.New("consumer instance is nil")
+	}
+	return nil
+}
+
+func (qc defaultTestQueueCaller) consumeMessages(ctx context.Context, cInst consumerInstanceURI) ([]Record, error) {
 	if len(cInst.BaseURI) == 0 {
 		return nil, errors.New("consumer instance is nil")
 	}
-	return msgsTestByteA, nil
+	return parseRecords(msgsTestByteA)
 }
 
-func (qc defaultTestQueueCaller) commitOffsets(cInst consumerInstanceURI) error {
+func (qc defaultTestQueueCaller) commitOffsets(ctx context.Context, cInst consumerInstanceURI, offsets []PartitionOffset) error {
 	if len(cInst.BaseURI) == 0 {
 		return errors.New("consumer instance is nil")
 	}
@@ -154,6 +202,23 @@ func (qc defaultTestQueueCaller) checkConnectivity() error {
 	return nil
 }
 
+//counts keep-alive and fetch requests
+type countingTestQueueCaller struct {
+	defaultTestQueueCaller
+	keepAlives atomic.Int32
+	fetches    atomic.Int32
+}
+
+func (qc *countingTestQueueCaller) keepAliveConsumerInstance(cInst consumerInstanceURI) error {
+	qc.keepAlives.Add(1)
+	return qc.defaultTestQueueCaller.keepAliveConsumerInstance(cInst)
+}
+
+func (qc *countingTestQueueCaller) consumeMessages(ctx context.Context, cInst consumerInstanceURI) ([]Record, error) {
+	qc.fetches.Add(1)
+	return qc.defaultTestQueueCaller.consumeMessages(context.Background(), cInst)
+}
+
 //return error on consume and destroy
 type consumeMsgErrorQueueCaller struct {
 	qc defaultTestQueueCaller
@@ -175,11 +240,15 @@ func (qc consumeMsgErrorQueueCaller) destroyConsumerInstanceSubscription(cInst c
 	return errors.New("error while destroying subscription")
 }
 
-func (qc consumeMsgErrorQueueCaller) consumeMessages(cInst consumerInstanceURI) ([]byte, error) {
+func (qc consumeMsgErrorQueueCaller) keepAliveConsumerInstance(cInst consumerInstanceURI) error {
+	return errors.New("error while keeping alive")
+}
+
+func (qc consumeMsgErrorQueueCaller) consumeMessages(ctx context.Context, cInst consumerInstanceURI) ([]Record, error) {
 	return nil, errors.New("error while consuming")
 }
 
-func (qc consumeMsgErrorQueueCaller) commitOffsets(cInst consumerInstanceURI) error {
+func (qc consumeMsgErrorQueueCaller) commitOffsets(ctx context.Context, cInst consumerInstanceURI, offsets []PartitionOffset) error {
 	return errors.New("error while committing offsets")
 }
 
@@ -207,14 +276,42 @@ func (qc consumeMsgPanicQueueCaller) destroyConsumerInstanceSubscription(cInst c
 	return errors.New("error while destroying subscription")
 }
 
-func (qc consumeMsgPanicQueueCaller) consumeMessages(cInst consumerInstanceURI) ([]byte, error) {
+func (qc consumeMsgPanicQueueCaller) keepAliveConsumerInstance(cInst consumerInstanceURI) error {
+	return errors.New("error while keeping alive")
+}
+
+func (qc consumeMsgPanicQueueCaller) consumeMessages(ctx context.Context, cInst consumerInstanceURI) ([]Record, error) {
 	return nil, errors.New("error while consuming")
 }
 
-func (qc consumeMsgPanicQueueCaller) commitOffsets(cInst consumerInstanceURI) error {
+func (qc consumeMsgPanicQueueCaller) commitOffsets(ctx context.Context, cInst consumerInstanceURI, offsets []PartitionOffset) error {
 	return errors.New("error while committing offsets")
 }
 
 func (qc consumeMsgPanicQueueCaller) checkConnectivity() error {
 	return errors.New("connectivity error")
 }
+
+func TestInstanceName(t *testing.T) {
+	hostname, err := os.Hostname()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "", instanceName(QueueConfig{}, 1))
+	assert.Equal(t, "fixed", instanceName(QueueConfig{ConsumerProperties: ConsumerProperties{Name: "fixed"}}, 1))
+	assert.Equal(t, "fixed-1", instanceName(QueueConfig{StreamCount: 2, ConsumerProperties: ConsumerProperties{Name: "fixed"}}, 1), "the streams should not share a name")
+	assert.Equal(t, "writer-"+hostname+"-2", instanceName(QueueConfig{NamedInstances: true, ConsumerProperties: ConsumerProperties{Name: "writer"}}, 2))
+	assert.Equal(t, hostname+"-0", instanceName(QueueConfig{NamedInstances: true}, 0))
+}
+
+var _ CircuitBreakerChecker = &Consumer{}
+var _ CircuitBreakerChecker = &FailoverConsumer{}
+var _ LagChecker = &Consumer{}
+var _ LagChecker = &FailoverConsumer{}
+
+func TestMaxPollInterval(t *testing.T) {
+	c := &consumerInstance{config: QueueConfig{}}
+	assert.Equal(t, 5*time.Minute, c.maxPollInterval())
+
+	c.config.ConsumerProperties.Extra = map[string]string{"max.poll.interval.ms": "600000"}
+	assert.Equal(t, 10*time.Minute, c.maxPollInterval())
+}
@@ -0,0 +1,226 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultTokenRefreshBefore = 30 * time.Second
+
+// CredentialsProvider supplies the Authorization header of the requests sent to the REST proxy.
+type CredentialsProvider interface {
+	// Authorization returns the value of the Authorization header, or an empty string to send none
+	Authorization(ctx context.Context) (string, error)
+	// Invalidate is called with the Authorization header value the proxy rejected with a 401 response.
+	// Unless it has already been replaced, the next call to Authorization has to obtain new credentials.
+	// It reports whether the request is worth retrying, which it is once with the new credentials.
+	Invalidate(rejected string) bool
+}
+
+// StaticKey returns a CredentialsProvider always sending the given Authorization header value
+func StaticKey(key string) CredentialsProvider {
+	return staticKey(key)
+}
+
+type staticKey string
+
+func (k staticKey) Authorization(ctx context.Context) (string, error) {
+	return string(k), nil
+}
+
+// Invalidate reports that the request is not worth retrying, as the key never changes
+func (k staticKey) Invalidate(rejected string) bool {
+	return false
+}
+
+// ClientCredentialsConfig configures the OAuth2 client credentials grant.
+type ClientCredentialsConfig struct {
+	//URL of the token endpoint of the authorization server
+	TokenURL string
+	//client authenticated with HTTP basic authentication
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	//period before the expiry of the token it is refreshed. Defaults to 30 seconds, capped at half the lifetime of the token.
+	RefreshBefore time.Duration
+	//client used for the token requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// ClientCredentials is a CredentialsProvider obtaining bearer tokens with the OAuth2 client credentials grant.
+// Tokens are cached and refreshed before they expire.
+type ClientCredentials struct {
+	config ClientCredentialsConfig
+
+	mu      sync.Mutex
+	token   string
+	refresh time.Time
+}
+
+// NewClientCredentials returns a ClientCredentials provider for the config
+func NewClientCredentials(config ClientCredentialsConfig) *ClientCredentials {
+	if config.RefreshBefore <= 0 {
+		config.RefreshBefore = defaultTokenRefreshBefore
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	return &ClientCredentials{config: config}
+}
+
+// Authorization returns the cached bearer token, requesting a new one if it is about to expire
+func (c *ClientCredentials) Authorization(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == "" || !time.Now().Before(c.refresh) {
+		if err := c.requestToken(ctx); err != nil {
+			return "", err
+		}
+	}
+	return "Bearer " + c.token, nil
+}
+
+// Invalidate drops the cached token if it is the rejected one, so a token refreshed meanwhile is kept
+func (c *ClientCredentials) Invalidate(rejected string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if rejected == "Bearer "+c.token {
+		c.token = ""
+	}
+	return true
+}
+
+func (c *ClientCredentials) requestToken(ctx context.Context) error {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.config.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("error creating token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(c.config.ClientSecret))
+
+	resp, err := c.config.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error requesting token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error requesting token: %w", &unexpectedStatusError{resp.StatusCode, http.StatusOK})
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("error unmarshalling token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return errors.New("token response has no access token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return fmt.Errorf("unsupported token type %s", token.TokenType)
+	}
+
+	c.token = token.AccessToken
+	if token.ExpiresIn > 0 {
+		lifetime := time.Duration(token.ExpiresIn) * time.Second
+		// short-lived tokens would otherwise be refreshed on every request
+		before := c.config.RefreshBefore
+		if before > lifetime/2 {
+			before = lifetime / 2
+		}
+		c.refresh = time.Now().Add(lifetime - before)
+	} else {
+		// tokens without expiry are kept until the proxy rejects them
+		c.refresh = time.Now().Add(100 * 365 * 24 * time.Hour)
+	}
+	return nil
+}
+
+// FileToken is a CredentialsProvider sending the bearer token stored in a file.
+// The file is read again whenever it is modified, e.g. when the token is rotated by a sidecar.
+type FileToken struct {
+	path string
+
+	mu       sync.Mutex
+	token    string
+	modified time.Time
+	size     int64
+}
+
+// NewFileToken returns a FileToken provider reading the token from the file at path
+func NewFileToken(path string) *FileToken {
+	return &FileToken{path: path}
+}
+
+// Authorization returns the token of the file, reading it again if the file changed since it was last read
+func (f *FileToken) Authorization(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("error reading token file: %w", err)
+	}
+	if f.token == "" || !info.ModTime().Equal(f.modified) || info.Size() != f.size {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return "", fmt.Errorf("error reading token file: %w", err)
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("token file %s is empty", f.path)
+		}
+		f.token, f.modified, f.size = token, info.ModTime(), info.Size()
+	}
+	return "Bearer " + f.token, nil
+}
+
+// Invalidate makes the next call to Authorization read the file again, unless the rejected token was already replaced
+func (f *FileToken) Invalidate(rejected string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rejected == "Bearer "+f.token {
+		f.token = ""
+	}
+	return true
+}
+
+// credentialsError is returned when no credentials could be obtained for a request, which is not a failure of the proxy
+type credentialsError struct {
+	err error
+}
+
+func (e *credentialsError) Error() string {
+	return "error obtaining credentials: " + e.err.Error()
+}
+
+func (e *credentialsError) Unwrap() error {
+	return e.err
+}
+
+// credentials returns the provider configured for the queue, falling back to the static AuthorizationKey
+func credentials(config QueueConfig) CredentialsProvider {
+	if config.Credentials != nil {
+		return config.Credentials
+	}
+	if config.AuthorizationKey != "" {
+		return StaticKey(config.AuthorizationKey)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticKey(t *testing.T) {
+	auth, err := StaticKey("secret").Authorization(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", auth)
+	assert.False(t, StaticKey("secret").Invalidate("secret"))
+
+	assert.Equal(t, StaticKey("key"), credentials(QueueConfig{AuthorizationKey: "key"}))
+	assert.Nil(t, credentials(QueueConfig{}))
+}
+
+func TestClientCredentialsCachesAndRefreshesToken(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		id, secret, _ := r.BasicAuth()
+		assert.Equal(t, "client", id)
+		assert.Equal(t, "secret", secret)
+		assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+		assert.Equal(t, "read write", r.FormValue("scope"))
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":60}`, n)
+	}))
+	defer server.Close()
+
+	creds := NewClientCredentials(ClientCredentialsConfig{TokenURL: server.URL, ClientID: "client", ClientSecret: "secret", Scopes: []string{"read", "write"}})
+	for i := 0; i < 2; i++ {
+		auth, err := creds.Authorization(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "Bearer token-1", auth)
+	}
+	assert.Equal(t, int32(1), requests.Load(), "the token should be cached")
+
+	creds.refresh = time.Now()
+	auth, err := creds.Authorization(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer token-2", auth, "a token about to expire should be refreshed")
+
+	assert.True(t, creds.Invalidate("Bearer token-1"))
+	auth, err = creds.Authorization(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer token-2", auth, "a token refreshed since the rejected one was sent should be kept")
+
+	assert.True(t, creds.Invalidate("Bearer token-2"))
+	auth, err = creds.Authorization(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer token-3", auth)
+}
+
+func TestClientCredentialsRefreshMarginIsCappedByLifetime(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, `{"access_token":"token","expires_in":20}`)
+	}))
+	defer server.Close()
+
+	creds := NewClientCredentials(ClientCredentialsConfig{TokenURL: server.URL})
+	for i := 0; i < 3; i++ {
+		_, err := creds.Authorization(context.Background())
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), requests.Load(), "a token living less than RefreshBefore should still be cached")
+	assert.WithinDuration(t, time.Now().Add(10*time.Second), creds.refresh, time.Second)
+}
+
+func TestClientCredentialsTokenError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := NewClientCredentials(ClientCredentialsConfig{TokenURL: server.URL}).Authorization(context.Background())
+	assert.EqualError(t, err, "error requesting token: unexpected response status 401. Expected: 200")
+}
+
+func TestFileTokenIsReadAgainWhenRotated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(path, []byte("first\n"), 0600))
+
+	creds := NewFileToken(path)
+	auth, err := creds.Authorization(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer first", auth)
+
+	assert.NoError(t, os.WriteFile(path, []byte("second-token\n"), 0600))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	auth, err = creds.Authorization(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer second-token", auth)
+
+	assert.NoError(t, os.Remove(path))
+	_, err = creds.Authorization(context.Background())
+	assert.Error(t, err)
+}
+
+func TestUnauthorizedRequestIsRetriedWithRefreshedCredentials(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body := make([]byte, 4)
+		n, _ := r.Body.Read(body)
+		assert.Equal(t, "body", string(body[:n]), "the body should be sent again")
+		if r.Header.Get("Authorization") != "Bearer 2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	creds := &countingCredentials{}
+	data, err := httpClient{credentials: creds, client: server.Client()}.DoReq(context.Background(), "POST", server.URL, strings.NewReader("body"), nil, http.StatusOK)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(data))
+	assert.Equal(t, int32(2), requests.Load())
+
+	creds.stale = true
+	_, err = httpClient{credentials: creds, client: server.Client()}.DoReq(context.Background(), "POST", server.URL, strings.NewReader("body"), nil, http.StatusOK)
+	assert.EqualError(t, err, "unexpected response status 401. Expected: 200")
+	assert.Equal(t, int32(4), requests.Load(), "the request should be retried only once")
+}
+
+func TestUnauthorizedStaticKeyIsNotRetried(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := httpClient{credentials: StaticKey("key"), client: server.Client()}.DoReq(context.Background(), "GET", server.URL, nil, nil, http.StatusOK)
+	assert.EqualError(t, err, "unexpected response status 401. Expected: 200")
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestCredentialsErrorIsNotAProxyFailure(t *testing.T) {
+	_, err := httpClient{credentials: NewFileToken("/does/not/exist"), client: http.DefaultClient}.DoReq(context.Background(), "GET", "http://localhost:0", nil, nil, http.StatusOK)
+	assert.Error(t, err)
+	assert.False(t, isProxyFailure(err))
+}
+
+// returns increasing tokens on every invalidation, or always a rejected one if stale
+type countingCredentials struct {
+	token int
+	stale bool
+}
+
+func (c *countingCredentials) Authorization(ctx context.Context) (string, error) {
+	if c.stale {
+		return "Bearer stale", nil
+	}
+	if c.token == 0 {
+		c.token = 1
+	}
+	return fmt.Sprintf("Bearer %d", c.token), nil
+}
+
+func (c *countingCredentials) Invalidate(rejected string) bool {
+	if c.token > 0 && rejected == fmt.Sprintf("Bearer %d", c.token) {
+		c.token++
+	}
+	return true
+}
@@ -0,0 +1,259 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Financial-Times/go-logger/v2"
+)
+
+const (
+	// PrimaryCluster is the name of the primary cluster of a FailoverConsumer
+	PrimaryCluster = "primary"
+	// SecondaryCluster is the name of the secondary cluster of a FailoverConsumer
+	SecondaryCluster = "secondary"
+
+	defaultFailoverCheckInterval = 10
+	defaultFailoverAfter         = 60
+	defaultFailbackAfter         = 60
+)
+
+// FailoverConfig represents the configuration of a consumer failing over between a primary and a secondary cluster
+type FailoverConfig struct {
+	//configuration of the consumer of the primary cluster, with its own addresses, authorization and group
+	Primary QueueConfig `json:"primary"`
+	//configuration of the consumer of the secondary cluster, with its own addresses, authorization and group
+	Secondary QueueConfig `json:"secondary"`
+	//period in seconds between the connectivity checks of the primary cluster. Defaults to 10.
+	CheckInterval int `json:"checkInterval"`
+	//period in seconds none of the proxies of the primary cluster has to be reachable before failing over to the secondary. Defaults to 60.
+	FailoverAfter int `json:"failoverAfter"`
+	//period in seconds the primary cluster has to be reachable again before failing back to it. Defaults to 60.
+	FailbackAfter int `json:"failbackAfter"`
+	//called with the name of the cluster the consumption switched to, after the switch
+	OnSwitch func(cluster string) `json:"-"`
+}
+
+// FailoverConsumer consumes from the primary cluster while it is reachable and fails over to the secondary cluster
+// when none of the proxies of the primary has been reachable for the configured period, provided the secondary is reachable.
+// It fails back once the primary has been reachable again for the configured period. Only one of the clusters is consumed at a time:
+// the consumer of the active cluster is stopped before the other one is started.
+type FailoverConsumer struct {
+	consumers     [2]MessageConsumer
+	checkInterval time.Duration
+	failoverAfter time.Duration
+	failbackAfter time.Duration
+	onSwitch      func(cluster string)
+	shutdownChan  chan bool
+	logger        *log.UPPLogger
+
+	mu     sync.Mutex
+	active int
+	paused bool
+}
+
+// NewFailoverConsumer returns a consumer failing over between the clusters of the config.
+// newConsumer builds the consumer of a cluster from its configuration, e.g. with NewConsumer.
+// The consumers built are stopped and started again on every switch, so they must support
+// being started again after they were stopped, like the consumers of this package do.
+func NewFailoverConsumer(config FailoverConfig, newConsumer func(config QueueConfig) MessageConsumer, logger *log.UPPLogger) *FailoverConsumer {
+	return &FailoverConsumer{
+		consumers:     [2]MessageConsumer{newConsumer(config.Primary), newConsumer(config.Secondary)},
+		checkInterval: secondsOrDefault(config.CheckInterval, defaultFailoverCheckInterval),
+		failoverAfter: secondsOrDefault(config.FailoverAfter, defaultFailoverAfter),
+		failbackAfter: secondsOrDefault(config.FailbackAfter, defaultFailbackAfter),
+		onSwitch:      config.OnSwitch,
+		shutdownChan:  make(chan bool, 1),
+		logger:        logger,
+	}
+}
+
+func secondsOrDefault(seconds, defaultSeconds int) time.Duration {
+	if seconds <= 0 {
+		seconds = defaultSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func clusterName(cluster int) string {
+	if cluster == 0 {
+		return PrimaryCluster
+	}
+	return SecondaryCluster
+}
+
+// ActiveCluster returns the name of the cluster currently consumed
+func (f *FailoverConsumer) ActiveCluster() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return clusterName(f.active)
+}
+
+// Start consumes the active cluster and switches between the clusters until Stop is called.
+// It is a blocking method, like Consumer.Start.
+func (f *FailoverConsumer) Start() {
+	for {
+		c := f.activate()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.Start()
+		}()
+
+		next, stopped := f.monitor()
+		c.Stop()
+		<-done
+		if stopped {
+			return
+		}
+		f.switchTo(next)
+	}
+}
+
+// activate returns the consumer of the active cluster, paused or resumed like the FailoverConsumer
+func (f *FailoverConsumer) activate() MessageConsumer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.consumers[f.active]
+	if f.paused {
+		c.Pause()
+	} else {
+		c.Resume()
+	}
+	return c
+}
+
+func (f *FailoverConsumer) switchTo(cluster int) {
+	f.mu.Lock()
+	f.active = cluster
+	f.mu.Unlock()
+
+	f.logger.Infof("Switched consumption to the %s cluster", clusterName(cluster))
+	if f.onSwitch != nil {
+		f.onSwitch(clusterName(cluster))
+	}
+}
+
+// monitor checks the connectivity of the primary cluster until the consumption has to switch to the other cluster
+// or Stop is called. It returns the cluster to switch to and whether Stop was called.
+func (f *FailoverConsumer) monitor() (int, bool) {
+	ticker := time.NewTicker(f.checkInterval)
+	defer ticker.Stop()
+
+	var since time.Time
+	for {
+		select {
+		case <-f.shutdownChan:
+			return 0, true
+		case <-ticker.C:
+		}
+
+		err := reachability(f.consumers[0])
+		active := f.activeCluster()
+		// on the primary cluster failures count towards a failover, on the secondary successes count towards a failback
+		if (active == 0) == (err == nil) {
+			since = time.Time{}
+			continue
+		}
+		if since.IsZero() {
+			since = time.Now()
+		}
+		if active == 0 && time.Since(since) >= f.failoverAfter {
+			if secondaryErr := reachability(f.consumers[1]); secondaryErr != nil {
+				f.logger.WithError(secondaryErr).Errorf("Primary cluster unreachable for %s, but the secondary cluster is unreachable too", f.failoverAfter)
+				continue
+			}
+			f.logger.WithError(err).Errorf("Primary cluster unreachable for %s, failing over", f.failoverAfter)
+			return 1, false
+		}
+		if active == 1 && time.Since(since) >= f.failbackAfter {
+			f.logger.Infof("Primary cluster reachable for %s, failing back", f.failbackAfter)
+			return 0, false
+		}
+	}
+}
+
+// reachabilityChecker is implemented by the consumers which can tell whether any of their proxies is reachable,
+// while their ConnectivityCheck fails as soon as one of them is not
+type reachabilityChecker interface {
+	checkReachable() error
+}
+
+// reachability returns an error if the cluster of the consumer cannot be consumed
+func reachability(c MessageConsumer) error {
+	if r, ok := c.(reachabilityChecker); ok {
+		return r.checkReachable()
+	}
+	_, err := c.ConnectivityCheck()
+	return err
+}
+
+func (f *FailoverConsumer) activeCluster() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.active
+}
+
+// Stop stops the consumption of the active cluster
+func (f *FailoverConsumer) Stop() {
+	f.shutdownChan <- true
+}
+
+// Pause suspends the consumption of the active cluster. The consumption stays paused after a switch.
+func (f *FailoverConsumer) Pause() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paused = true
+	f.consumers[f.active].Pause()
+}
+
+// Resume continues the consumption of the active cluster after Pause was called
+func (f *FailoverConsumer) Resume() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paused = false
+	f.consumers[f.active].Resume()
+}
+
+// ConnectivityCheck returns the connectivity status of the active cluster.
+// Consuming from the secondary cluster is reported in the message but is not an error.
+func (f *FailoverConsumer) ConnectivityCheck() (string, error) {
+	f.mu.Lock()
+	active := f.active
+	f.mu.Unlock()
+
+	msg, err := f.consumers[active].ConnectivityCheck()
+	if err != nil {
+		return fmt.Sprintf("%s (%s cluster)", msg, clusterName(active)), err
+	}
+	if active == 1 {
+		_, primaryErr := f.consumers[0].ConnectivityCheck()
+		if primaryErr == nil {
+			primaryErr = errors.New("waiting to fail back")
+		}
+		return fmt.Sprintf("%s Consuming from the secondary cluster: %s", msg, primaryErr.Error()), nil
+	}
+	return msg, nil
+}
+
+// CircuitBreakerCheck returns the state of the handler circuit breakers of the active cluster
+func (f *FailoverConsumer) CircuitBreakerCheck() (string, error) {
+	active := f.activeCluster()
+	checker, ok := f.consumers[active].(CircuitBreakerChecker)
+	if !ok {
+		return fmt.Sprintf("The consumer of the %s cluster has no circuit breakers.", clusterName(active)), nil
+	}
+	return checker.CircuitBreakerCheck()
+}
+
+// LagCheck returns the lag of the partitions of the active cluster
+func (f *FailoverConsumer) LagCheck() (string, error) {
+	active := f.activeCluster()
+	checker, ok := f.consumers[active].(LagChecker)
+	if !ok {
+		return fmt.Sprintf("The consumer of the %s cluster does not monitor its lag.", clusterName(active)), nil
+	}
+	return checker.LagCheck()
+}
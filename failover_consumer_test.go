@@ -0,0 +1,195 @@
+package consumer
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClusterConsumer struct {
+	reachable atomic.Bool
+	running   atomic.Bool
+	paused    atomic.Bool
+	starts    atomic.Int32
+	stop      chan bool
+}
+
+func newFakeClusterConsumer() *fakeClusterConsumer {
+	c := &fakeClusterConsumer{stop: make(chan bool, 1)}
+	c.reachable.Store(true)
+	return c
+}
+
+func (c *fakeClusterConsumer) Start() {
+	c.starts.Add(1)
+	c.running.Store(true)
+	<-c.stop
+	c.running.Store(false)
+}
+
+func (c *fakeClusterConsumer) Stop()   { c.stop <- true }
+func (c *fakeClusterConsumer) Pause()  { c.paused.Store(true) }
+func (c *fakeClusterConsumer) Resume() { c.paused.Store(false) }
+
+func (c *fakeClusterConsumer) ConnectivityCheck() (string, error) {
+	if !c.reachable.Load() {
+		return "Error connecting to consumer proxies", errors.New("unreachable")
+	}
+	return "Connectivity to consumer proxies is OK.", nil
+}
+
+func (c *fakeClusterConsumer) CircuitBreakerCheck() (string, error) {
+	return "Message handler circuit breakers are closed.", nil
+}
+
+// waitFor fails the test if the condition does not become true within a second
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (c *fakeClusterConsumer) LagCheck() (string, error) {
+	return "Consumer lag is within threshold, 0 records behind.", nil
+}
+
+func newTestFailoverConsumer(onSwitch func(cluster string)) (*FailoverConsumer, *fakeClusterConsumer, *fakeClusterConsumer) {
+	primary, secondary := newFakeClusterConsumer(), newFakeClusterConsumer()
+	config := FailoverConfig{
+		Primary:   QueueConfig{Group: "primary"},
+		Secondary: QueueConfig{Group: "secondary"},
+		OnSwitch:  onSwitch,
+	}
+	f := NewFailoverConsumer(config, func(config QueueConfig) MessageConsumer {
+		if config.Group == "primary" {
+			return primary
+		}
+		return secondary
+	}, log.NewUPPLogger("Test", "FATAL"))
+	f.checkInterval = 5 * time.Millisecond
+	f.failoverAfter = 20 * time.Millisecond
+	f.failbackAfter = 20 * time.Millisecond
+	return f, primary, secondary
+}
+
+func TestFailoverConsumerFailsOverAndBack(t *testing.T) {
+	var mu sync.Mutex
+	var switches []string
+	f, primary, secondary := newTestFailoverConsumer(func(cluster string) {
+		mu.Lock()
+		defer mu.Unlock()
+		switches = append(switches, cluster)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.Start()
+	}()
+
+	waitFor(t, primary.running.Load)
+
+	primary.reachable.Store(false)
+	waitFor(t, secondary.running.Load)
+	assert.False(t, primary.running.Load())
+	assert.Equal(t, SecondaryCluster, f.ActiveCluster())
+	msg, err := f.ConnectivityCheck()
+	assert.NoError(t, err)
+	assert.Contains(t, msg, "secondary cluster")
+
+	primary.reachable.Store(true)
+	waitFor(t, func() bool { return primary.starts.Load() == 2 })
+	assert.Equal(t, PrimaryCluster, f.ActiveCluster())
+
+	f.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("failover consumer did not stop")
+	}
+	assert.False(t, primary.running.Load())
+	assert.False(t, secondary.running.Load())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{SecondaryCluster, PrimaryCluster}, switches)
+}
+
+func TestFailoverConsumerIgnoresShortOutages(t *testing.T) {
+	f, primary, secondary := newTestFailoverConsumer(nil)
+	f.failoverAfter = time.Hour
+
+	go f.Start()
+	defer f.Stop()
+
+	primary.reachable.Store(false)
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, PrimaryCluster, f.ActiveCluster())
+	assert.Equal(t, int32(0), secondary.starts.Load())
+}
+
+func TestFailoverConsumerKeepsPauseAcrossSwitch(t *testing.T) {
+	f, primary, secondary := newTestFailoverConsumer(nil)
+	f.Pause()
+
+	go f.Start()
+	defer f.Stop()
+
+	waitFor(t, primary.running.Load)
+	assert.True(t, primary.paused.Load())
+
+	primary.reachable.Store(false)
+	waitFor(t, secondary.running.Load)
+	assert.True(t, secondary.paused.Load())
+
+	f.Resume()
+	assert.False(t, secondary.paused.Load())
+}
+
+func TestFailoverConsumerStaysOnPrimaryWhileSecondaryIsUnreachable(t *testing.T) {
+	f, primary, secondary := newTestFailoverConsumer(nil)
+	secondary.reachable.Store(false)
+
+	go f.Start()
+	defer f.Stop()
+
+	waitFor(t, primary.running.Load)
+	primary.reachable.Store(false)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, PrimaryCluster, f.ActiveCluster())
+	assert.Equal(t, int32(0), secondary.starts.Load())
+
+	secondary.reachable.Store(true)
+	waitFor(t, secondary.running.Load)
+	assert.Equal(t, SecondaryCluster, f.ActiveCluster())
+}
+
+func TestClusterIsReachableWhileAnyProxyIs(t *testing.T) {
+	proxy1 := setupMockKafka(t, 200, mockedTopics)
+	defer proxy1.Close()
+	proxy2 := setupMockKafka(t, 500, "")
+	defer proxy2.Close()
+
+	config := consumerConfigMock
+	config.Addrs = []string{proxy1.URL, proxy2.URL}
+	c := NewConsumer(config, func(m Message) {}, &http.Client{}, log.NewUPPLogger("Test", "FATAL"))
+	_, err := c.ConnectivityCheck()
+	assert.Error(t, err)
+	assert.NoError(t, reachability(c), "one failing proxy should not fail the cluster over")
+
+	config.Addrs = []string{proxy2.URL}
+	c = NewConsumer(config, func(m Message) {}, &http.Client{}, log.NewUPPLogger("Test", "FATAL"))
+	assert.EqualError(t, reachability(c), "could not connect to proxy: unexpected response status 500. Expected: 200; ")
+}
@@ -0,0 +1,229 @@
+package consumer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultReplayBatchSize = 100
+
+// FileBackend is a Backend replaying records from files, so a service can run locally against captured traffic.
+//
+// The path is either a JSON-lines file or a directory. Every line of a JSON-lines file holds either a records
+// response of the REST proxy (an array of records) or a single record. In a directory, the files with the .json
+// or .jsonl extensions, or whose content starts with a JSON array or object, like the files of a recorder with
+// a RecordPath without extension, are read as JSON-lines files. Any other file is read as a single FT message.
+// The files of a directory are replayed in the order of their names.
+//
+// The records are shared by all the instances, each record is fetched only once.
+// When all the records are replayed, Fetch returns no records.
+// Close releases the file being replayed once the backend is not used anymore.
+type FileBackend struct {
+	path      string
+	batchSize int
+
+	mu        sync.Mutex
+	files     []string
+	reader    *bufio.Reader
+	file      *os.File
+	pending   []Record
+	offset    int
+	instances int
+}
+
+// NewFileBackend returns a FileBackend replaying the records at path in batches of at most batchSize records.
+// A batchSize of 0 defaults to 100.
+func NewFileBackend(path string, batchSize int) (*FileBackend, error) {
+	files, err := replayFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if batchSize <= 0 {
+		batchSize = defaultReplayBatchSize
+	}
+	return &FileBackend{path: path, batchSize: batchSize, files: files}, nil
+}
+
+func replayFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading replay path: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading replay directory: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			files = append(files, filepath.Join(path, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// CreateInstance returns a new instance ID. The instances share the replayed records.
+func (b *FileBackend) CreateInstance() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.instances++
+	return "replay-" + strconv.Itoa(b.instances), nil
+}
+
+// Subscribe does nothing as the instances replay all the records of the path
+func (b *FileBackend) Subscribe(instance string) error {
+	return nil
+}
+
+// Fetch returns the next batch of at most batchSize records, or no records when all of them are replayed
+func (b *FileBackend) Fetch(instance string) ([]Record, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(b.pending) < b.batchSize {
+		records, err := b.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		b.pending = append(b.pending, records...)
+	}
+
+	n := b.batchSize
+	if len(b.pending) < n {
+		n = len(b.pending)
+	}
+	records := b.pending[:n:n]
+	b.pending = b.pending[n:]
+	return records, nil
+}
+
+// Commit does nothing as replayed records are never fetched again
+func (b *FileBackend) Commit(instance string, offsets []PartitionOffset) error {
+	return nil
+}
+
+// CloseInstance does nothing as the instances hold no resources
+func (b *FileBackend) CloseInstance(instance string) error {
+	return nil
+}
+
+// Close closes the file being replayed. The records which were not fetched yet are not replayed anymore.
+func (b *FileBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.files = nil
+	b.pending = nil
+	return b.closeFile()
+}
+
+func (b *FileBackend) closeFile() error {
+	b.reader = nil
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	b.file = nil
+	return err
+}
+
+// CheckConnectivity returns an error if the replay path cannot be read
+func (b *FileBackend) CheckConnectivity() error {
+	if _, err := os.Stat(b.path); err != nil {
+		return fmt.Errorf("replay path is not readable: %w", err)
+	}
+	return nil
+}
+
+// next returns the records of the next line of the current JSON-lines file or the next message file.
+// It returns io.EOF when all files are read.
+func (b *FileBackend) next() ([]Record, error) {
+	for {
+		if b.reader == nil {
+			if len(b.files) == 0 {
+				return nil, io.EOF
+			}
+			name := b.files[0]
+			b.files = b.files[1:]
+			// a path given as a file is always a JSON-lines file
+			if !isJSONLinesFile(name) && name != b.path {
+				records, ok, err := b.readMessageFile(name)
+				if ok || err != nil {
+					return records, err
+				}
+			}
+			f, err := os.Open(name)
+			if err != nil {
+				return nil, fmt.Errorf("error opening replay file: %w", err)
+			}
+			b.file = f
+			b.reader = bufio.NewReader(f)
+		}
+
+		line, err := b.reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			b.closeFile()
+			return nil, fmt.Errorf("error reading replay file: %w", err)
+		}
+		if errors.Is(err, io.EOF) {
+			b.closeFile()
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		return parseReplayLine(line)
+	}
+}
+
+// readMessageFile returns the record of a message file. It reports false if the file holds JSON lines instead.
+func (b *FileBackend) readMessageFile(name string) ([]Record, bool, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading message file: %w", err)
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return nil, false, nil
+	}
+	record := Record{Topic: filepath.Base(b.path), Offset: b.offset, Value: data}
+	b.offset++
+	return []Record{record}, true, nil
+}
+
+func isJSONLinesFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".json" || ext == ".jsonl"
+}
+
+// parseReplayLine parses a line holding either a records response or a single record
+func parseReplayLine(line []byte) ([]Record, error) {
+	if line[0] == '[' {
+		return parseRecords(line)
+	}
+	var record restRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, fmt.Errorf("error parsing json record %q: %w", line, err)
+	}
+	// the recorded values are base64 encoded whatever their format
+	rec := record.record(BinaryFormat)
+	rec.format = record.Format
+	return []Record{rec}, nil
+}
@@ -0,0 +1,96 @@
+package consumer
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileBackendReplaysDirectory(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "1-captured.jsonl"), append(msgsTestByteA,
+		[]byte("\n\n"+`{"topic":"test","value":"RlRNU0cvMS4wCgpib2R5Cg==","partition":1,"offset":5}`)...), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "2-message.txt"), []byte("FTMSG/1.0\r\nMessage-Id: 0000\r\n\r\n{}"), 0600))
+
+	backend, err := NewFileBackend(dir, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, backend.CheckConnectivity())
+	logger := log.NewUPPLogger("Test", "FATAL")
+
+	records, err := backend.Fetch("replay-1")
+	assert.NoError(t, err)
+	b, err := decodeRecords(records, decodeBinaryValue, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, msgsTest, messagesOf(b.msgs))
+
+	records, err = backend.Fetch("replay-2")
+	assert.NoError(t, err)
+	b, err = decodeRecords(records, decodeBinaryValue, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, []Message{{Body: "body"}, {Headers: map[string]string{"Message-Id": "0000"}, Body: "{}"}}, messagesOf(b.msgs))
+	assert.Equal(t, []PartitionOffset{{"test", 1, 5}, {filepath.Base(dir), 0, 0}}, b.offsets)
+
+	records, err = backend.Fetch("replay-1")
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestFileBackendThroughConsumer(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "captured.jsonl")
+	assert.NoError(t, os.WriteFile(file, msgsTestByteA, 0600))
+	backend, err := NewFileBackend(file, 0)
+	assert.NoError(t, err)
+
+	handled := make(chan []Message, 1)
+	c, err := NewBatchedBackendConsumer(QueueConfig{BackoffPeriod: 1}, func(m []Message) error {
+		handled <- m
+		return nil
+	}, backend, &http.Client{}, log.NewUPPLogger("Test", "FATAL"))
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		c.Start()
+		wg.Done()
+	}()
+	assert.Equal(t, msgsTest, <-handled)
+	c.Stop()
+	wg.Wait()
+}
+
+func TestFileBackendErrors(t *testing.T) {
+	_, err := NewFileBackend(filepath.Join(t.TempDir(), "missing.jsonl"), 0)
+	assert.Error(t, err)
+
+	file := filepath.Join(t.TempDir(), "invalid.jsonl")
+	assert.NoError(t, os.WriteFile(file, []byte("not json\n"), 0600))
+	backend, err := NewFileBackend(file, 0)
+	assert.NoError(t, err)
+	_, err = backend.Fetch("replay-1")
+	assert.Error(t, err)
+}
+
+func TestFileBackendClose(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "captured.jsonl")
+	assert.NoError(t, os.WriteFile(file, append(append(msgsTestByteA, '\n'), msgsTestByteA...), 0600))
+	backend, err := NewFileBackend(file, 1)
+	assert.NoError(t, err)
+
+	records, err := backend.Fetch("replay-1")
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.NotNil(t, backend.file)
+
+	assert.NoError(t, backend.Close())
+	assert.Nil(t, backend.file)
+	records, err = backend.Fetch("replay-1")
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+	assert.NoError(t, backend.Close())
+}
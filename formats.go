@@ -0,0 +1,161 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Financial-Times/go-logger/v2"
+)
+
+// Embedded formats of the records supported by the REST proxy
+const (
+	BinaryFormat = "binary"
+	JSONFormat   = "json"
+	AvroFormat   = "avro"
+)
+
+var embeddedFormats = map[string]bool{
+	BinaryFormat: true, // base64 encoded FT messages
+	JSONFormat:   true, // JSON values, strings are parsed as FT messages
+	AvroFormat:   true, // Avro values decoded to JSON by the proxy
+}
+
+// Headers added to the messages consumed in the Avro format
+const (
+	ValueSchemaIDHeader = "Value-Schema-Id"
+	ValueSchemaHeader   = "Value-Schema"
+)
+
+// SchemaRegistry resolves the Avro schemas of the consumed records
+type SchemaRegistry interface {
+	Schema(id int) (string, error)
+}
+
+// valueDecoder turns a record into a Message according to the embedded format of the consumer instance
+type valueDecoder func(m Record, logger *log.UPPLogger) (Message, error)
+
+// recordsContentType returns the Accept header of the records requests for the embedded format.
+// The binary format of the instances created without a format is requested with the generic v2 content type.
+func recordsContentType(format string) string {
+	if format == "" {
+		return msgContentType
+	}
+	return "application/vnd.kafka." + format + ".v2+json"
+}
+
+// newConfiguredValueDecoder returns the valueDecoder for the embedded format of the config.
+// The configured SchemaRegistry takes precedence over the one at SchemaRegistryURL.
+func newConfiguredValueDecoder(config QueueConfig, client *http.Client) valueDecoder {
+	registry := config.SchemaRegistry
+	if registry == nil && config.SchemaRegistryURL != "" {
+		registry = newSchemaRegistryClient(config.SchemaRegistryURL, client)
+	}
+	return newValueDecoder(config.ConsumerProperties.Format, registry)
+}
+
+func newValueDecoder(format string, registry SchemaRegistry) valueDecoder {
+	switch format {
+	case JSONFormat:
+		return decodeJSONValue
+	case AvroFormat:
+		return func(m Record, logger *log.UPPLogger) (Message, error) {
+			msg, err := decodeJSONValue(m, logger)
+			if err != nil || m.ValueSchemaID == nil || registry == nil {
+				return msg, err
+			}
+			schema, err := registry.Schema(*m.ValueSchemaID)
+			if err != nil {
+				return Message{}, &schemaError{id: *m.ValueSchemaID, err: err}
+			}
+			if msg.Headers == nil {
+				msg.Headers = make(map[string]string)
+			}
+			msg.Headers[ValueSchemaIDHeader] = strconv.Itoa(*m.ValueSchemaID)
+			msg.Headers[ValueSchemaHeader] = schema
+			return msg, nil
+		}
+	default:
+		return decodeBinaryValue
+	}
+}
+
+// schemaError is returned when the schema of a record cannot be resolved. Unlike malformed records,
+// such records are not skipped: the registry may be unavailable only for a while, so the fetch fails
+// and the records are consumed again.
+type schemaError struct {
+	id  int
+	err error
+}
+
+func (e *schemaError) Error() string {
+	return fmt.Sprintf("error resolving schema %d: %v", e.id, e.err)
+}
+
+func (e *schemaError) Unwrap() error {
+	return e.err
+}
+
+func decodeBinaryValue(m Record, logger *log.UPPLogger) (Message, error) {
+	if m.err != nil {
+		return Message{}, m.err
+	}
+	return parseFTMessage(string(m.Value), logger), nil
+}
+
+// decodeJSONValue parses string values as FT messages, any other value becomes the body of the message
+func decodeJSONValue(m Record, logger *log.UPPLogger) (Message, error) {
+	if m.err != nil {
+		return Message{}, m.err
+	}
+	var text string
+	if err := json.Unmarshal(m.Value, &text); err == nil {
+		return parseFTMessage(text, logger), nil
+	}
+
+	var body bytes.Buffer
+	if err := json.Compact(&body, m.Value); err != nil {
+		return Message{}, fmt.Errorf("error decoding json value: %w", err)
+	}
+	return Message{Body: body.String()}, nil
+}
+
+// schemaRegistryClient resolves schemas through the REST API of the Confluent Schema Registry.
+// The schemas are immutable, so they are cached by ID.
+type schemaRegistryClient struct {
+	addr   string
+	client *http.Client
+	cache  sync.Map
+}
+
+func newSchemaRegistryClient(addr string, client *http.Client) *schemaRegistryClient {
+	return &schemaRegistryClient{addr: strings.TrimRight(addr, "/"), client: client}
+}
+
+func (r *schemaRegistryClient) Schema(id int) (string, error) {
+	if schema, ok := r.cache.Load(id); ok {
+		return schema.(string), nil
+	}
+
+	resp, err := r.client.Get(r.addr + "/schemas/ids/" + strconv.Itoa(id))
+	if err != nil {
+		return "", fmt.Errorf("error executing request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response status %d. Expected: %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("error unmarshalling json content: %w", err)
+	}
+	r.cache.Store(id, body.Schema)
+	return body.Schema, nil
+}
@@ -0,0 +1,105 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordsContentType(t *testing.T) {
+	assert.Equal(t, "application/vnd.kafka.v2+json", recordsContentType(""))
+	assert.Equal(t, "application/vnd.kafka.binary.v2+json", recordsContentType(BinaryFormat))
+	assert.Equal(t, "application/vnd.kafka.json.v2+json", recordsContentType(JSONFormat))
+	assert.Equal(t, "application/vnd.kafka.avro.v2+json", recordsContentType(AvroFormat))
+}
+
+func TestParseJSONFormatBatch(t *testing.T) {
+	data := []byte(`[{"topic":"test","value":{"uuid": "c4b96810", "type": "Article"},"partition":0,"offset":0},` +
+		`{"topic":"test","value":"FTMSG/1.0\nMessage-Id: 0000-1111-0000-abcd\n\n[]","partition":0,"offset":1}]`)
+
+	b, err := parseBatch(data, JSONFormat, newValueDecoder(JSONFormat, nil), log.NewUPPLogger("Test", "FATAL"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Message{
+		{Body: `{"uuid":"c4b96810","type":"Article"}`},
+		{Headers: map[string]string{"Message-Id": "0000-1111-0000-abcd"}, Body: "[]"},
+	}, messagesOf(b.msgs))
+}
+
+func TestParseAvroFormatBatchResolvesSchemas(t *testing.T) {
+	data := []byte(`[{"topic":"test","value":{"uuid": "c4b96810"},"partition":0,"offset":0,"value_schema_id":7},` +
+		`{"topic":"test","value":{"uuid": "a391mmav"},"partition":0,"offset":1}]`)
+	registry := fakeSchemaRegistry{7: `{"type":"record","name":"Content"}`}
+
+	b, err := parseBatch(data, AvroFormat, newValueDecoder(AvroFormat, registry), log.NewUPPLogger("Test", "FATAL"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Message{
+		{Headers: map[string]string{ValueSchemaIDHeader: "7", ValueSchemaHeader: `{"type":"record","name":"Content"}`}, Body: `{"uuid":"c4b96810"}`},
+		{Body: `{"uuid":"a391mmav"}`},
+	}, messagesOf(b.msgs))
+	assert.Equal(t, []PartitionOffset{{"test", 0, 1}}, b.offsets)
+}
+
+func TestParseAvroFormatBatchFailsOnUnresolvedSchemas(t *testing.T) {
+	data := []byte(`[{"topic":"test","value":{"uuid": "c4b96810"},"partition":0,"offset":0,"value_schema_id":7},` +
+		`{"topic":"test","value":{"uuid": "be8132e8"},"partition":0,"offset":1,"value_schema_id":8},` +
+		`{"topic":"test","value":"not a message","partition":0,"offset":2}]`)
+	registry := fakeSchemaRegistry{7: `{"type":"record","name":"Content"}`}
+
+	b, err := parseBatch(data, AvroFormat, newValueDecoder(AvroFormat, registry), log.NewUPPLogger("Test", "FATAL"))
+	var schemaErr *schemaError
+	assert.ErrorAs(t, err, &schemaErr, "records with unresolved schemas should fail the fetch instead of being skipped")
+	assert.Empty(t, b.offsets, "no offset of the batch should be committed")
+}
+
+func TestSchemaRegistryClientCachesSchemas(t *testing.T) {
+	requests := 0
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		assert.Equal(t, "/schemas/ids/7", req.URL.Path)
+		_, _ = w.Write([]byte(`{"schema": "{\"type\":\"string\"}"}`))
+	}))
+	defer registry.Close()
+
+	client := newSchemaRegistryClient(registry.URL+"/", &http.Client{})
+	for i := 0; i < 2; i++ {
+		schema, err := client.Schema(7)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"type":"string"}`, schema)
+	}
+	assert.Equal(t, 1, requests)
+}
+
+type fakeSchemaRegistry map[int]string
+
+func (r fakeSchemaRegistry) Schema(id int) (string, error) {
+	schema, ok := r[id]
+	if !ok {
+		return "", errors.New("schema not found")
+	}
+	return schema, nil
+}
+
+// returns an Avro record with the given schema
+type avroRecordQueueCaller struct {
+	defaultTestQueueCaller
+	schemaID int
+}
+
+func (qc avroRecordQueueCaller) consumeMessages(ctx context.Context, cInst consumerInstanceURI) ([]Record, error) {
+	return []Record{{Topic: "test", Value: []byte(`{"uuid":"c4b96810"}`), Offset: 3, ValueSchemaID: &qc.schemaID}}, nil
+}
+
+func TestUnresolvedSchemaFailsFetchWithoutCommitting(t *testing.T) {
+	c := &consumerInstance{config: QueueConfig{}, queue: avroRecordQueueCaller{schemaID: 8}, consumer: consInstTest, shutdownChan: make(chan bool),
+		decode: newValueDecoder(AvroFormat, fakeSchemaRegistry{}), logger: log.NewUPPLogger("Test", "FATAL")}
+
+	_, err := c.fetch()
+	assert.Error(t, err)
+	assert.Empty(t, c.uncommitted)
+	assert.Nil(t, c.consumer, "the instance should be recreated to consume the records again")
+}
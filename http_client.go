@@ -1,24 +1,80 @@
 package consumer
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Implementation of the httpCaller interface
 type httpClient struct {
-	hostHeader       string
-	authorizationKey string
-	client           *http.Client
+	hostHeader  string
+	credentials CredentialsProvider
+	client      *http.Client
 }
 
-func (c httpClient) DoReq(method, url string, body io.Reader, headers map[string]string, expectedStatus int) ([]byte, error) {
-	req, err := http.NewRequest(method, url, body)
+// DoReq sends the request. If the context carries a span, the request is traced with a child span
+// and the trace context is propagated to the proxy. A request rejected with a 401 response
+// is retried once with refreshed credentials.
+func (c httpClient) DoReq(ctx context.Context, method, url string, body io.Reader, headers map[string]string, expectedStatus int) (data []byte, err error) {
+	ctx, span := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, "HTTP "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.request.method", method), attribute.String("url.full", url)))
+	defer func() { endSpan(span, err) }()
+
+	var payload []byte
+	if body != nil {
+		// the body is kept to be sent again if the credentials are refreshed
+		if payload, err = ioutil.ReadAll(body); err != nil {
+			return nil, fmt.Errorf("error reading request body: %w", err)
+		}
+	}
+
+	authorization, err := c.authorization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err = c.send(ctx, span, method, url, payload, headers, authorization, expectedStatus)
+	var statusErr *unexpectedStatusError
+	if errors.As(err, &statusErr) && statusErr.status == http.StatusUnauthorized && c.credentials != nil && c.credentials.Invalidate(authorization) {
+		if authorization, err = c.authorization(ctx); err != nil {
+			return nil, err
+		}
+		data, err = c.send(ctx, span, method, url, payload, headers, authorization, expectedStatus)
+	}
+	return data, err
+}
+
+// authorization returns the Authorization header value of the credentials, if any
+func (c httpClient) authorization(ctx context.Context) (string, error) {
+	if c.credentials == nil {
+		return "", nil
+	}
+	authorization, err := c.credentials.Authorization(ctx)
+	if err != nil {
+		return "", &credentialsError{err}
+	}
+	return authorization, nil
+}
+
+func (c httpClient) send(ctx context.Context, span trace.Span, method, url string, payload []byte, headers map[string]string, authorization string, expectedStatus int) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
+	traceContext.Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	for k, v := range headers {
 		req.Header.Add(k, v)
@@ -27,8 +83,8 @@ func (c httpClient) DoReq(method, url string, body io.Reader, headers map[string
 		req.Host = c.hostHeader
 	}
 
-	if len(c.authorizationKey) > 0 {
-		req.Header.Add("Authorization", c.authorizationKey)
+	if len(authorization) > 0 {
+		req.Header.Set("Authorization", authorization)
 	}
 
 	resp, err := c.client.Do(req)
@@ -36,6 +92,7 @@ func (c httpClient) DoReq(method, url string, body io.Reader, headers map[string
 		return nil, fmt.Errorf("error executing request: %w", err)
 	}
 
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 	defer func() {
 		_, _ = io.Copy(ioutil.Discard, resp.Body)
 		resp.Body.Close()
@@ -44,15 +101,22 @@ func (c httpClient) DoReq(method, url string, body io.Reader, headers map[string
 			// of the DNS pool, but because we might still have a tcp connection open, we'll
 			// never re-do the DNS lookup and get a connection to a working server.  So when we
 			// get 5xx, close idle connections to force the next requests to re-connect.
-			if t, ok := c.client.Transport.(*http.Transport); ok {
-				t.CloseIdleConnections()
-			}
+			closeIdleConnections(transportOf(c.client))
 		}
 	}()
 
 	if resp.StatusCode != expectedStatus {
-		return nil, fmt.Errorf("unexpected response status %d. Expected: %d", resp.StatusCode, expectedStatus)
+		return nil, &unexpectedStatusError{resp.StatusCode, expectedStatus}
 	}
 
 	return ioutil.ReadAll(resp.Body)
 }
+
+type unexpectedStatusError struct {
+	status   int
+	expected int
+}
+
+func (e *unexpectedStatusError) Error() string {
+	return fmt.Sprintf("unexpected response status %d. Expected: %d", e.status, e.expected)
+}
@@ -1,20 +1,114 @@
 package consumer
 
+import (
+	"strconv"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
 //QueueConfig represents the configuration of the queue, consumer group and topic the consumer interested about.
 type QueueConfig struct {
-	Addrs                []string `json:"address"` //list of queue addresses.
-	Group                string   `json:"group"`
-	Topic                string   `json:"topic"`
-	Queue                string   `json:"queue"` //The name of the queue.
-	Offset               string   `json:"offset"`
-	BackoffPeriod        int      `json:"backoffPeriod"`
-	StreamCount          int      `json:"streamCount"`
-	ConcurrentProcessing bool     `json:"concurrentProcessing"`
-	AuthorizationKey     string   `json:"authorizationKey"`
-	AutoCommitEnable     bool     `json:"autoCommitEnable"`
-	NoOfProcessors       int      `json:"noOfProcessors"`
+	Addrs                   []string             `json:"address"` //list of queue addresses.
+	Group                   string               `json:"group"`
+	Topic                   string               `json:"topic"`
+	Queue                   string               `json:"queue"` //The name of the queue.
+	Offset                  string               `json:"offset"`
+	BackoffPeriod           int                  `json:"backoffPeriod"`
+	StreamCount             int                  `json:"streamCount"`
+	ConcurrentProcessing    bool                 `json:"concurrentProcessing"`
+	AuthorizationKey        string               `json:"authorizationKey"`
+	AutoCommitEnable        bool                 `json:"autoCommitEnable"`
+	NoOfProcessors          int                  `json:"noOfProcessors"`
+	Credentials             CredentialsProvider  `json:"-"`                       //provides the Authorization header of every request to the proxy, takes precedence over AuthorizationKey
+	TLS                     *TLSConfig           `json:"tls,omitempty"`           //client certificate, CA and TLS settings of the connections to the proxy. The transport of the client, if set, must be an *http.Transport and is cloned.
+	CircuitBreakerThreshold int                  `json:"circuitBreakerThreshold"` //number of consecutive handler failures after which the consumption is suspended, failed messages are handled again until then. 0 disables the circuit breaker and failed messages are committed.
+	CircuitBreakerCoolDown  int                  `json:"circuitBreakerCoolDown"`  //period in seconds to wait before probing a failing handler again. Defaults to 30.
+	RateLimit               float64              `json:"rateLimit"`               //maximum number of messages handed to the handler per second. 0 disables rate limiting.
+	RateLimitBurst          int                  `json:"rateLimitBurst"`          //maximum number of messages handled in a burst. Defaults to the rate limit rounded up.
+	RateLimitPerStream      bool                 `json:"rateLimitPerStream"`      //whether the rate limit applies to every stream separately instead of to all streams together.
+	MaxWorkers              int                  `json:"maxWorkers"`              //maximum number of messages processed concurrently by all the streams when ConcurrentProcessing is enabled. Defaults to NoOfProcessors for every stream.
+	WorkerQueueDepth        int                  `json:"workerQueueDepth"`        //number of messages waiting for a free worker before the streams are blocked. Defaults to 128.
+	Prefetch                bool                 `json:"prefetch"`                //whether the next batch of messages is fetched while the current one is processed. The offsets are committed explicitly in order, even if AutoCommitEnable is set.
+	PrefetchBuffer          int                  `json:"prefetchBuffer"`          //number of fetched batches buffered while waiting to be processed when Prefetch is enabled. Defaults to 1.
+	FetchTimeout            int                  `json:"fetchTimeout"`            //maximum time in milliseconds the proxy waits for records before returning an empty response. Enables long polling, so empty polls are not followed by the backoff period.
+	FetchMaxBytes           int                  `json:"fetchMaxBytes"`           //maximum size in bytes of the records returned by a single request.
+	MinBatchSize            int                  `json:"minBatchSize"`            //minimum number of messages handed to the processor at once. Records are requested until it is reached or a request returns no records.
+	MaxBatchSize            int                  `json:"maxBatchSize"`            //maximum number of messages handed to a batch handler at once. Messages are accumulated across requests until it is reached. Ignored by the consumers handling messages one by one.
+	MaxBatchBytes           int                  `json:"maxBatchBytes"`           //size in bytes of the message bodies after which the accumulated messages are handed to the processor.
+	MaxBatchWait            int                  `json:"maxBatchWait"`            //maximum time in milliseconds messages are accumulated across requests before they are handed to the processor. Defaults to 1000 when a batch limit is set. The timeout of the requests is capped at the remaining time.
+	ConsumerProperties      ConsumerProperties   `json:"consumerProperties"`      //properties of the consumer instances created on the proxy.
+	NamedInstances          bool                 `json:"namedInstances"`          //whether the consumer instances get deterministic names built from ConsumerProperties.Name, the hostname and the stream index. A stale instance with the same name is deleted before a new one is created. Otherwise no instance is ever deleted by name.
+	SchemaRegistryURL       string               `json:"schemaRegistryURL"`       //address of the schema registry resolving the schemas of the records consumed in the avro format.
+	SchemaRegistry          SchemaRegistry       `json:"-"`                       //schema registry client used instead of the one at SchemaRegistryURL.
+	APIVersion              string               `json:"apiVersion"`              //version of the REST proxy API: v2 (default) or v3. The v3 API is used where supported, messages are always consumed through v2.
+	ClusterID               string               `json:"clusterID"`               //ID of the kafka cluster used by the v3 API. Defaults to the first cluster of the proxy.
+	RecordPath              string               `json:"recordPath"`              //path of the JSON-lines file recording every fetched record. Empty disables recording.
+	RecordMaxBytes          int64                `json:"recordMaxBytes"`          //size in bytes after which the record file is rotated. Defaults to 100MB.
+	RecordMaxFiles          int                  `json:"recordMaxFiles"`          //number of rotated record files kept. Defaults to 5.
+	ProxyFailureThreshold   int                  `json:"proxyFailureThreshold"`   //number of consecutive failures after which a proxy address is skipped. Defaults to 3.
+	ProxyCoolDown           int                  `json:"proxyCoolDown"`           //period in seconds a failing proxy address is skipped before it is probed again. Defaults to 30.
+	TracerProvider          trace.TracerProvider `json:"-"`                       //provider of the tracer creating the spans of the consumer. Defaults to the global provider.
+	LagCheckInterval        int                  `json:"lagCheckInterval"`        //period in seconds between the measurements of the lag of the consumed partitions. 0 (default) disables lag monitoring.
+	LagThreshold            int64                `json:"lagThreshold"`            //lag of a partition above which the lag check fails. 0 (default) never fails.
+	Observer                Observer             `json:"-"`                       //notified of the lifecycle events of the consumer instances
+	PanicHandler            PanicHandler         `json:"-"`                       //called with the panics recovered from the message handler, deciding whether to skip, retry or stop. Panics are skipped by default.
+	PanicMaxAttempts        int                  `json:"panicMaxAttempts"`        //number of attempts at handling messages whose handler panics with PanicRetry, after which the stream stops like with PanicStop. Defaults to 5.
+	BatchRetries            int                  `json:"batchRetries"`            //number of times the messages which failed in a batch are handed to a result handler again. Default value is 0.
+	CommitEvery             int                  `json:"commitEvery"`             //number of processed messages after which their offsets are committed, when AutoCommitEnable is false. 0 (default) commits after every poll unless CommitInterval is set.
+	CommitInterval          int                  `json:"commitInterval"`          //period in seconds after which the offsets of the processed messages are committed, when AutoCommitEnable is false. Offsets are also committed before a consumer instance is destroyed, except the ones of revoked partitions.
+	DeadLetterTopic         string               `json:"deadLetterTopic"`         //topic the messages which failed in a batch are written to, with the v3 API, after the retries of a result handler. A message which cannot be written to it opens the circuit breaker of a result handler, even when CircuitBreakerThreshold is 0.
+}
+
+//ConsumerProperties represents the properties sent to the proxy when creating a consumer instance.
+//Zero values are not sent, so the proxy defaults apply.
+type ConsumerProperties struct {
+	Name                 string            `json:"name"`                 //name of the consumer instance, suffixed with the stream index when StreamCount > 1.
+	Format               string            `json:"format"`               //embedded format of the records: binary, json or avro.
+	FetchMinBytes        int               `json:"fetchMinBytes"`        //fetch.min.bytes
+	RequestTimeoutMs     int               `json:"requestTimeoutMs"`     //consumer.request.timeout.ms
+	AutoCommitIntervalMs int               `json:"autoCommitIntervalMs"` //auto.commit.interval.ms
+	Extra                map[string]string `json:"extra"`                //any other consumer property, the typed properties take precedence.
+}
+
+// request returns the body of the consumer instance creation request
+func (p ConsumerProperties) request(offset string, autoCommitEnable bool) map[string]interface{} {
+	req := make(map[string]interface{}, len(p.Extra)+7)
+	for k, v := range p.Extra {
+		req[k] = v
+	}
+	if p.Name != "" {
+		req["name"] = p.Name
+	}
+	if p.Format != "" {
+		req["format"] = p.Format
+	}
+	if p.FetchMinBytes > 0 {
+		req["fetch.min.bytes"] = p.FetchMinBytes
+	}
+	if p.RequestTimeoutMs > 0 {
+		req["consumer.request.timeout.ms"] = p.RequestTimeoutMs
+	}
+	if p.AutoCommitIntervalMs > 0 {
+		req["auto.commit.interval.ms"] = p.AutoCommitIntervalMs
+	}
+	req["auto.offset.reset"] = offset
+	req["auto.commit.enable"] = strconv.FormatBool(autoCommitEnable)
+	return req
 }
 
 type consumerInstanceURI struct {
 	BaseURI string `json:"base_uri"`
 }
+
+//PartitionOffset represents the offset of the last record processed from a topic partition
+type PartitionOffset struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int    `json:"offset"`
+}
+
+//TopicPartition identifies a partition of a topic
+type TopicPartition struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+}
@@ -0,0 +1,225 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PartitionLag is the number of records of a partition the consumer group has not committed yet
+type PartitionLag struct {
+	Topic           string `json:"topic"`
+	Partition       int    `json:"partition"`
+	CommittedOffset int64  `json:"committedOffset"`
+	EndOffset       int64  `json:"endOffset"`
+	Lag             int64  `json:"lag"`
+}
+
+// lagMetrics publishes the lag of the partitions consumed by the process, keyed by group/instance/topic/partition,
+// so the consumer instances of the process, even of the same group, do not overwrite each other
+var lagMetrics = expvar.NewMap("kafka_consumer_lag")
+
+// lagCaller is implemented by the queue callers which can measure the lag of the partitions assigned to an instance
+type lagCaller interface {
+	partitionLags(c consumerInstanceURI) ([]PartitionLag, error)
+}
+
+// lagMonitor holds the lag of the partitions assigned to a consumer instance, measured every interval.
+// A nil lagMonitor does not measure the lag.
+type lagMonitor struct {
+	interval  time.Duration
+	threshold int64
+	group     string
+
+	mu      sync.Mutex
+	checked time.Time
+	lags    []PartitionLag
+	//keys of the published metrics
+	keys []string
+}
+
+// newLagMonitor returns a lagMonitor for the config, or nil if the lag is not monitored
+func newLagMonitor(config QueueConfig) *lagMonitor {
+	if config.LagCheckInterval <= 0 {
+		return nil
+	}
+	return &lagMonitor{
+		interval:  time.Duration(config.LagCheckInterval) * time.Second,
+		threshold: config.LagThreshold,
+		group:     config.Group,
+	}
+}
+
+// due reports whether the lag has to be measured, and if so, starts a new interval
+func (m *lagMonitor) due() bool {
+	if m == nil {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if time.Since(m.checked) < m.interval {
+		return false
+	}
+	m.checked = time.Now()
+	return true
+}
+
+// update replaces the measured lags of the consumer instance and publishes them to the metrics
+func (m *lagMonitor) update(instance consumerInstanceURI, lags []PartitionLag) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range m.keys {
+		lagMetrics.Delete(key)
+	}
+	m.keys = nil
+	for _, l := range lags {
+		v := new(expvar.Int)
+		v.Set(l.Lag)
+		key := m.metricKey(instance, l)
+		lagMetrics.Set(key, v)
+		m.keys = append(m.keys, key)
+	}
+	m.lags = lags
+}
+
+// metricKey returns the key of the lag of the partition, naming the instance by the last segment of its URI
+func (m *lagMonitor) metricKey(instance consumerInstanceURI, l PartitionLag) string {
+	return m.group + "/" + path.Base(instance.BaseURI) + "/" + l.Topic + "/" + strconv.Itoa(l.Partition)
+}
+
+func (m *lagMonitor) current() []PartitionLag {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]PartitionLag(nil), m.lags...)
+}
+
+// check returns an error listing the partitions whose lag exceeds the threshold
+func (m *lagMonitor) check() error {
+	if m == nil || m.threshold <= 0 {
+		return nil
+	}
+	errMsg := ""
+	for _, l := range m.current() {
+		if l.Lag > m.threshold {
+			errMsg = errMsg + fmt.Sprintf("partition %d of topic %s is %d records behind, threshold is %d; ", l.Partition, l.Topic, l.Lag, m.threshold)
+		}
+	}
+	if errMsg != "" {
+		return errors.New(errMsg)
+	}
+	return nil
+}
+
+// assignmentsBody is the body of the assignments response, and of the committed offsets request
+type assignmentsBody struct {
+	Partitions []TopicPartition `json:"partitions"`
+}
+
+// assignments returns the partitions assigned to the consumer instance
+func (q *kafkaRESTClient) assignments(c consumerInstanceURI) ([]TopicPartition, error) {
+	uri, err := q.buildConsumerURL(c)
+	if err != nil {
+		return nil, fmt.Errorf("error building consumer URL: %w", err)
+	}
+	uri.Path = strings.TrimRight(uri.Path, "/") + "/assignments"
+	data, err := q.doReq(context.Background(), q.addrs[q.addrInd], "GET", uri.String(), nil, map[string]string{"Accept": msgContentType}, http.StatusOK)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting partition assignments: %w", err)
+	}
+	var assignments assignmentsBody
+	if err := json.Unmarshal(data, &assignments); err != nil {
+		return nil, fmt.Errorf("error parsing partition assignments: %w", err)
+	}
+	return assignments.Partitions, nil
+}
+
+// partitionLags returns the lag of the partitions assigned to the consumer instance,
+// comparing the offsets committed by the group to the end offsets of the partitions
+func (q *kafkaRESTClient) partitionLags(c consumerInstanceURI) ([]PartitionLag, error) {
+	uri, err := q.buildConsumerURL(c)
+	if err != nil {
+		return nil, fmt.Errorf("error building consumer URL: %w", err)
+	}
+	addr := q.addrs[q.addrInd]
+	instancePath := strings.TrimRight(uri.Path, "/")
+
+	partitions, err := q.assignments(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(partitions) == 0 {
+		return nil, nil
+	}
+
+	reqBody, err := json.Marshal(assignmentsBody{Partitions: partitions})
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling partitions: %w", err)
+	}
+	uri.Path = instancePath + "/offsets"
+	data, err := q.doReq(context.Background(), addr, "GET", uri.String(), bytes.NewReader(reqBody), map[string]string{"Content-Type": msgContentType, "Accept": msgContentType}, http.StatusOK)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting committed offsets: %w", err)
+	}
+	var committed struct {
+		Offsets []struct {
+			Topic     string `json:"topic"`
+			Partition int    `json:"partition"`
+			Offset    int64  `json:"offset"`
+		} `json:"offsets"`
+	}
+	if err := json.Unmarshal(data, &committed); err != nil {
+		return nil, fmt.Errorf("error parsing committed offsets: %w", err)
+	}
+	committedOffsets := make(map[TopicPartition]int64, len(committed.Offsets))
+	for _, o := range committed.Offsets {
+		committedOffsets[TopicPartition{o.Topic, o.Partition}] = o.Offset
+	}
+
+	lags := make([]PartitionLag, 0, len(partitions))
+	for _, p := range partitions {
+		beginning, end, err := q.partitionOffsets(addr, p)
+		if err != nil {
+			return nil, err
+		}
+		offset, ok := committedOffsets[p]
+		if !ok || offset < beginning {
+			// nothing committed yet, or the committed records were deleted, so every record is pending
+			offset = beginning
+		}
+		lags = append(lags, PartitionLag{Topic: p.Topic, Partition: p.Partition, CommittedOffset: offset, EndOffset: end, Lag: end - offset})
+	}
+	return lags, nil
+}
+
+// partitionOffsets returns the beginning and the end offsets of the partition
+func (q *kafkaRESTClient) partitionOffsets(addr string, p TopicPartition) (int64, int64, error) {
+	uri := addr + "/topics/" + url.PathEscape(p.Topic) + "/partitions/" + strconv.Itoa(p.Partition) + "/offsets"
+	data, err := q.doReq(context.Background(), addr, "GET", uri, nil, map[string]string{"Accept": msgContentType}, http.StatusOK)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error requesting offsets of partition %d of topic %s: %w", p.Partition, p.Topic, err)
+	}
+	var offsets struct {
+		Beginning int64 `json:"beginning_offset"`
+		End       int64 `json:"end_offset"`
+	}
+	if err := json.Unmarshal(data, &offsets); err != nil {
+		return 0, 0, fmt.Errorf("error parsing partition offsets: %w", err)
+	}
+	return offsets.Beginning, offsets.End, nil
+}
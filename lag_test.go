@@ -0,0 +1,164 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// routingHTTPCaller returns the response configured for the path of the requested URL
+type routingHTTPCaller struct {
+	responses map[string]string
+	bodies    map[string]string
+}
+
+func (r *routingHTTPCaller) DoReq(ctx context.Context, method, addr string, body io.Reader, headers map[string]string, expectedStatus int) ([]byte, error) {
+	path := strings.TrimPrefix(addr, "http://kafka-proxy")
+	if body != nil {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		r.bodies[path] = string(data)
+	}
+	response, ok := r.responses[path]
+	if !ok {
+		return nil, &unexpectedStatusError{404, expectedStatus}
+	}
+	return []byte(response), nil
+}
+
+func TestPartitionLags(t *testing.T) {
+	caller := &routingHTTPCaller{
+		responses: map[string]string{
+			"/consumers/group1/instances/rest-consumer-1-45864/assignments": `{"partitions":[{"topic":"topic","partition":0},{"topic":"topic","partition":1}]}`,
+			"/consumers/group1/instances/rest-consumer-1-45864/offsets":     `{"offsets":[{"topic":"topic","partition":0,"offset":90,"metadata":""}]}`,
+			"/topics/topic/partitions/0/offsets":                            `{"beginning_offset":10,"end_offset":100}`,
+			"/topics/topic/partitions/1/offsets":                            `{"beginning_offset":5,"end_offset":25}`,
+		},
+		bodies: map[string]string{},
+	}
+	q := &kafkaRESTClient{addrs: []string{"http://kafka-proxy"}, caller: caller}
+
+	lags, err := q.partitionLags(testConsumer)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []PartitionLag{
+		{Topic: "topic", Partition: 0, CommittedOffset: 90, EndOffset: 100, Lag: 10},
+		{Topic: "topic", Partition: 1, CommittedOffset: 5, EndOffset: 25, Lag: 20},
+	}, lags)
+	assert.JSONEq(t, `{"partitions":[{"topic":"topic","partition":0},{"topic":"topic","partition":1}]}`,
+		caller.bodies["/consumers/group1/instances/rest-consumer-1-45864/offsets"])
+}
+
+func TestPartitionLagsWithoutAssignments(t *testing.T) {
+	caller := &routingHTTPCaller{
+		responses: map[string]string{"/consumers/group1/instances/rest-consumer-1-45864/assignments": `{"partitions":[]}`},
+		bodies:    map[string]string{},
+	}
+	q := &kafkaRESTClient{addrs: []string{"http://kafka-proxy"}, caller: caller}
+
+	lags, err := q.partitionLags(testConsumer)
+
+	assert.NoError(t, err)
+	assert.Empty(t, lags)
+}
+
+func TestLagMonitorCheck(t *testing.T) {
+	m := newLagMonitor(QueueConfig{Group: "lag-check", LagCheckInterval: 60, LagThreshold: 15})
+
+	assert.True(t, m.due())
+	assert.False(t, m.due(), "the lag should be measured once per interval")
+
+	m.update(testConsumer, []PartitionLag{{Topic: "topic", Partition: 0, Lag: 10}})
+	assert.NoError(t, m.check())
+	assert.Equal(t, "10", lagMetrics.Get("lag-check/rest-consumer-1-45864/topic/0").String())
+
+	m.update(testConsumer, []PartitionLag{{Topic: "topic", Partition: 1, Lag: 20}})
+	assert.EqualError(t, m.check(), "partition 1 of topic topic is 20 records behind, threshold is 15; ")
+	assert.Nil(t, lagMetrics.Get("lag-check/rest-consumer-1-45864/topic/0"), "the metrics of unassigned partitions should be removed")
+	assert.Equal(t, "20", lagMetrics.Get("lag-check/rest-consumer-1-45864/topic/1").String())
+}
+
+func TestLagMetricsOfInstancesDoNotOverwriteEachOther(t *testing.T) {
+	config := QueueConfig{Group: "lag-instances", LagCheckInterval: 60}
+	first, second := newLagMonitor(config), newLagMonitor(config)
+	firstURI := consumerInstanceURI{BaseURI: "http://kafka-proxy/consumers/lag-instances/instances/first"}
+	secondURI := consumerInstanceURI{BaseURI: "http://kafka-proxy/consumers/lag-instances/instances/second/"}
+
+	first.update(firstURI, []PartitionLag{{Topic: "topic", Partition: 0, Lag: 10}})
+	second.update(secondURI, []PartitionLag{{Topic: "topic", Partition: 0, Lag: 20}})
+	first.update(firstURI, nil)
+
+	assert.Nil(t, lagMetrics.Get("lag-instances/first/topic/0"))
+	assert.Equal(t, "20", lagMetrics.Get("lag-instances/second/topic/0").String(),
+		"a partition revoked from an instance should keep the lag published by the instance it was assigned to")
+}
+
+func TestNilLagMonitor(t *testing.T) {
+	m := newLagMonitor(QueueConfig{})
+
+	m.update(testConsumer, []PartitionLag{{Topic: "topic", Lag: 10}})
+
+	assert.Nil(t, m)
+	assert.False(t, m.due())
+	assert.NoError(t, m.check())
+	assert.Empty(t, m.current())
+}
+
+type lagTestQueueCaller struct {
+	defaultTestQueueCaller
+	lags []PartitionLag
+	err  error
+}
+
+func (qc lagTestQueueCaller) partitionLags(cInst consumerInstanceURI) ([]PartitionLag, error) {
+	return qc.lags, qc.err
+}
+
+func TestConsumerLagCheck(t *testing.T) {
+	config := QueueConfig{Group: "consumer-lag", LagCheckInterval: 60, LagThreshold: 100}
+	logger := log.NewUPPLogger("Test", "FATAL")
+	behind := &consumerInstance{config: config, consumer: consInstTest, logger: logger, lag: newLagMonitor(config),
+		queue: lagTestQueueCaller{lags: []PartitionLag{{Topic: "topic", Partition: 0, Lag: 150}}}}
+	failing := &consumerInstance{config: config, consumer: consInstTest, logger: logger, lag: newLagMonitor(config),
+		queue: lagTestQueueCaller{err: errors.New("proxy unavailable")}}
+	c := Consumer{streamCount: 2, instanceHandlers: []instanceHandler{behind, failing}}
+
+	msg, err := c.LagCheck()
+	assert.NoError(t, err)
+	assert.Equal(t, "Consumer lag is within threshold, 0 records behind.", msg)
+
+	behind.measureLag()
+	failing.measureLag()
+
+	msg, err = c.LagCheck()
+	assert.Error(t, err)
+	assert.Equal(t, "Consumer is lagging behind", msg)
+	assert.Equal(t, []PartitionLag{{Topic: "topic", Partition: 0, Lag: 150}}, c.Lag())
+
+	behind.shutdown()
+	_, err = c.LagCheck()
+	assert.NoError(t, err, "the lag of a destroyed instance should be dropped")
+}
+
+func TestConsumerInstanceMeasuresLagWhenDue(t *testing.T) {
+	config := QueueConfig{Group: "lag-due", LagCheckInterval: 60}
+	c := &consumerInstance{config: config, consumer: consInstTest, logger: log.NewUPPLogger("Test", "FATAL"), lag: newLagMonitor(config),
+		queue: lagTestQueueCaller{lags: []PartitionLag{{Topic: "topic", Lag: 1}}}}
+
+	c.measureLag()
+	c.queue = lagTestQueueCaller{lags: []PartitionLag{{Topic: "topic", Lag: 2}}}
+	c.measureLag()
+	assert.Equal(t, int64(1), c.partitionLags()[0].Lag, "the lag should not be measured again before the interval")
+
+	c.lag.checked = time.Now().Add(-time.Minute)
+	c.measureLag()
+	assert.Equal(t, int64(2), c.partitionLags()[0].Lag)
+}
@@ -6,24 +6,45 @@ type Message struct {
 	Body    string
 }
 
-// splitMessageProcessor processes messages one by one
-type splitMessageProcessor struct {
-	handler func(m Message)
+// delivery is a fetched message with the position of its record
+type delivery struct {
+	Message
+	position PartitionOffset
 }
 
-func (p splitMessageProcessor) consume(msgs ...Message) {
-	for _, msg := range msgs {
-		p.handler(msg)
+func messagesOf(deliveries []delivery) []Message {
+	if deliveries == nil {
+		return nil
 	}
+	msgs := make([]Message, len(deliveries))
+	for i, m := range deliveries {
+		msgs[i] = m.Message
+	}
+	return msgs
 }
 
-// batchedMessageProcessor process messages in batches
-type batchedMessageProcessor struct {
-	handler func(m []Message)
+func positionsOf(deliveries []delivery) []PartitionOffset {
+	positions := make([]PartitionOffset, len(deliveries))
+	for i, m := range deliveries {
+		positions[i] = m.position
+	}
+	return positions
 }
 
-func (b batchedMessageProcessor) consume(msgs ...Message) {
-	if len(msgs) > 0 {
-		b.handler(msgs)
+// breakerProcessor hands the messages with their positions to the circuit breaker, one by one unless batched
+type breakerProcessor struct {
+	breaker *circuitBreaker
+	batched bool
+}
+
+func (p breakerProcessor) consume(msgs ...delivery) {
+	if p.batched {
+		if len(msgs) > 0 {
+			p.breaker.execute(msgs)
+		}
+		return
+	}
+	for _, m := range msgs {
+		p.breaker.execute([]delivery{m})
 	}
 }
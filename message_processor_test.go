@@ -0,0 +1,36 @@
+package consumer
+
+import (
+	"testing"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// splitProcessor hands the messages one by one to the handler through a breaker which never opens
+func splitProcessor(handler func(m Message)) breakerProcessor {
+	return breakerProcessor{breaker: newCircuitBreaker(QueueConfig{}, func(msgs []delivery) error {
+		handler(msgs[0].Message)
+		return nil
+	}, log.NewUPPLogger("Test", "FATAL"))}
+}
+
+// batchedProcessor hands the messages in batches to the handler through a breaker which never opens
+func batchedProcessor(handler func(m []Message)) breakerProcessor {
+	return breakerProcessor{breaker: newCircuitBreaker(QueueConfig{}, func(msgs []delivery) error {
+		handler(messagesOf(msgs))
+		return nil
+	}, log.NewUPPLogger("Test", "FATAL")), batched: true}
+}
+
+func TestBreakerProcessor(t *testing.T) {
+	var handled []Message
+	splitProcessor(func(m Message) { handled = append(handled, m) }).consume(deliveriesTest...)
+	assert.Equal(t, msgsTest, handled)
+
+	var batches [][]Message
+	p := batchedProcessor(func(m []Message) { batches = append(batches, m) })
+	p.consume()
+	p.consume(deliveriesTest...)
+	assert.Equal(t, [][]Message{msgsTest}, batches, "empty batches should not be handled")
+}
@@ -0,0 +1,168 @@
+package consumer
+
+import (
+	"sort"
+	"time"
+)
+
+const assignmentCheckInterval = 10 * time.Second
+
+// assignmentCaller is implemented by the queue callers which can list the partitions assigned to an instance
+type assignmentCaller interface {
+	assignments(c consumerInstanceURI) ([]TopicPartition, error)
+}
+
+// Observer is notified of the lifecycle events of the consumer instances, e.g. for alerting or auditing.
+// The instances are identified by their base URI, or by the ID of the instance for a Backend.
+// The methods are called from the goroutines of the consumer instances, so they must be safe to be called
+// concurrently and should return quickly, as the consumption waits for them.
+// Embed NoopObserver to implement only the events of interest.
+//
+// InstanceCreated and InstanceDestroyed are called after a consumer instance is created or destroyed on the proxy.
+//
+// Subscribed and Unsubscribed are called after the subscription of an instance to the topic is created or deleted.
+//
+// PartitionsAssigned and PartitionsRevoked are called when partitions are assigned to an instance or revoked from it.
+// The assignments are requested from the proxy when records of a partition not assigned yet are fetched, and at most
+// every 10 seconds otherwise. A Backend has no assignments, its partitions are assigned when their first records are
+// fetched and are never revoked.
+//
+// Fetched is called with the number of messages of every non-empty batch fetched, EmptyPoll when no records were
+// available and FetchFailed when fetching failed.
+//
+// Committed is called with the offsets committed by an instance, or nil if all the fetched records were committed,
+// CommitFailed when committing failed.
+//
+// BackingOff is called before an instance waits after a failure or an empty poll.
+//
+// PanicRecovered is called with the value recovered from a panic of the consumption.
+//
+// ShutDown is called when an instance stops consuming after the consumer was stopped.
+type Observer interface {
+	InstanceCreated(instance string)
+	InstanceDestroyed(instance string)
+	Subscribed(instance, topic string)
+	Unsubscribed(instance, topic string)
+	PartitionsAssigned(instance string, partitions []TopicPartition)
+	PartitionsRevoked(instance string, partitions []TopicPartition)
+	Fetched(instance string, count int)
+	FetchFailed(instance string, err error)
+	EmptyPoll(instance string)
+	Committed(instance string, offsets []PartitionOffset)
+	CommitFailed(instance string, err error)
+	BackingOff(instance string, period time.Duration)
+	PanicRecovered(instance string, recovered interface{})
+	ShutDown(instance string)
+}
+
+// NoopObserver ignores all the lifecycle events
+type NoopObserver struct{}
+
+func (NoopObserver) InstanceCreated(instance string)                                 {}
+func (NoopObserver) InstanceDestroyed(instance string)                               {}
+func (NoopObserver) Subscribed(instance, topic string)                               {}
+func (NoopObserver) Unsubscribed(instance, topic string)                             {}
+func (NoopObserver) PartitionsAssigned(instance string, partitions []TopicPartition) {}
+func (NoopObserver) PartitionsRevoked(instance string, partitions []TopicPartition)  {}
+func (NoopObserver) Fetched(instance string, count int)                              {}
+func (NoopObserver) FetchFailed(instance string, err error)                          {}
+func (NoopObserver) EmptyPoll(instance string)                                       {}
+func (NoopObserver) Committed(instance string, offsets []PartitionOffset)            {}
+func (NoopObserver) CommitFailed(instance string, err error)                         {}
+func (NoopObserver) BackingOff(instance string, period time.Duration)                {}
+func (NoopObserver) PanicRecovered(instance string, recovered interface{})           {}
+func (NoopObserver) ShutDown(instance string)                                        {}
+
+// observer returns the observer of the consumer instance, ignoring the events if none is configured
+func (c *consumerInstance) observer() Observer {
+	if c.config.Observer == nil {
+		return NoopObserver{}
+	}
+	return c.config.Observer
+}
+
+// instanceID returns the identifier of the consumer instance passed to the observer
+func (c *consumerInstance) instanceID() string {
+	if c.consumer == nil {
+		return ""
+	}
+	return c.consumer.BaseURI
+}
+
+// observeAssignments notifies the observer of the partitions assigned to the consumer instance or revoked from it
+// since the last check. The offsets pending on the revoked partitions are not committed.
+// The assignments are not requested if there is neither an observer nor a scheduled commit to use them.
+func (c *consumerInstance) observeAssignments(offsets []PartitionOffset) {
+	if c.config.Observer == nil && c.commits == nil {
+		return
+	}
+	q, ok := c.queue.(assignmentCaller)
+	if !ok {
+		c.observeFetchedPartitions(offsets)
+		return
+	}
+	unassigned := false
+	for _, o := range offsets {
+		if !c.partitions[TopicPartition{Topic: o.Topic, Partition: o.Partition}] {
+			unassigned = true
+		}
+	}
+	if !unassigned && time.Since(c.assignCheck) < assignmentCheckInterval {
+		return
+	}
+	c.assignCheck = time.Now()
+
+	partitions, err := q.assignments(*c.consumer)
+	if err != nil {
+		c.logger.WithError(err).Warn("Error requesting the partition assignments")
+		return
+	}
+	current := make(map[TopicPartition]bool, len(partitions))
+	var assigned, revoked []TopicPartition
+	for _, p := range partitions {
+		current[p] = true
+		if !c.partitions[p] {
+			assigned = append(assigned, p)
+		}
+	}
+	for p := range c.partitions {
+		if !current[p] {
+			revoked = append(revoked, p)
+		}
+	}
+	sort.Slice(revoked, func(i, j int) bool {
+		if revoked[i].Topic != revoked[j].Topic {
+			return revoked[i].Topic < revoked[j].Topic
+		}
+		return revoked[i].Partition < revoked[j].Partition
+	})
+	c.partitions = current
+	c.commits.revoke(revoked)
+
+	if len(revoked) > 0 {
+		c.observer().PartitionsRevoked(c.instanceID(), revoked)
+	}
+	if len(assigned) > 0 {
+		c.observer().PartitionsAssigned(c.instanceID(), assigned)
+	}
+}
+
+// observeFetchedPartitions notifies the observer of the partitions the consumer instance fetched records from for the first time,
+// for the queue callers without assignments.
+func (c *consumerInstance) observeFetchedPartitions(offsets []PartitionOffset) {
+	var assigned []TopicPartition
+	for _, o := range offsets {
+		p := TopicPartition{Topic: o.Topic, Partition: o.Partition}
+		if c.partitions[p] {
+			continue
+		}
+		if c.partitions == nil {
+			c.partitions = make(map[TopicPartition]bool)
+		}
+		c.partitions[p] = true
+		assigned = append(assigned, p)
+	}
+	if len(assigned) > 0 {
+		c.observer().PartitionsAssigned(c.instanceID(), assigned)
+	}
+}
@@ -0,0 +1,173 @@
+package consumer
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingObserver struct {
+	NoopObserver
+	mu     sync.Mutex
+	events []string
+}
+
+func (o *recordingObserver) record(format string, args ...interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, fmt.Sprintf(format, args...))
+}
+
+func (o *recordingObserver) recorded() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	events := o.events
+	o.events = nil
+	return events
+}
+
+func (o *recordingObserver) InstanceCreated(instance string)   { o.record("created %s", instance) }
+func (o *recordingObserver) InstanceDestroyed(instance string) { o.record("destroyed %s", instance) }
+func (o *recordingObserver) Subscribed(instance, topic string) {
+	o.record("subscribed %s to %s", instance, topic)
+}
+func (o *recordingObserver) Unsubscribed(instance, topic string) {
+	o.record("unsubscribed %s from %s", instance, topic)
+}
+func (o *recordingObserver) PartitionsAssigned(instance string, partitions []TopicPartition) {
+	o.record("assigned %v", partitions)
+}
+func (o *recordingObserver) PartitionsRevoked(instance string, partitions []TopicPartition) {
+	o.record("revoked %v", partitions)
+}
+func (o *recordingObserver) Fetched(instance string, count int)     { o.record("fetched %d", count) }
+func (o *recordingObserver) FetchFailed(instance string, err error) { o.record("fetch failed: %v", err) }
+func (o *recordingObserver) EmptyPoll(instance string)              { o.record("empty poll") }
+func (o *recordingObserver) Committed(instance string, offsets []PartitionOffset) {
+	o.record("committed %v", offsets)
+}
+func (o *recordingObserver) CommitFailed(instance string, err error) { o.record("commit failed: %v", err) }
+func (o *recordingObserver) BackingOff(instance string, period time.Duration) {
+	o.record("backing off %s", period)
+}
+func (o *recordingObserver) PanicRecovered(instance string, recovered interface{}) {
+	o.record("recovered %v", recovered)
+}
+func (o *recordingObserver) ShutDown(instance string) { o.record("shut down %s", instance) }
+
+func TestObserverIsNotifiedOfInstanceLifecycle(t *testing.T) {
+	observer := &recordingObserver{}
+	c := &consumerInstance{
+		config: QueueConfig{Topic: "topic", Observer: observer}, queue: defaultTestQueueCaller{},
+		processor: splitProcessor(func(m Message) {}), logger: log.NewUPPLogger("Test", "FATAL"),
+	}
+
+	_, err := c.consume()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"created /queue/consumergroup/instance-d",
+		"subscribed /queue/consumergroup/instance-d to topic",
+		"assigned [{ 0}]",
+		"fetched 2",
+		"committed []",
+	}, observer.recorded())
+
+	_, err = c.consume()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"fetched 2", "committed []"}, observer.recorded(), "known partitions should not be reported again")
+
+	c.shutdown()
+	assert.Equal(t, []string{
+		"unsubscribed /queue/consumergroup/instance-d from topic",
+		"destroyed /queue/consumergroup/instance-d",
+	}, observer.recorded())
+}
+
+type assigningQueueCaller struct {
+	scriptedQueueCaller
+	assigned [][]TopicPartition
+	requests int
+}
+
+func (qc *assigningQueueCaller) assignments(c consumerInstanceURI) ([]TopicPartition, error) {
+	qc.requests++
+	assigned := qc.assigned[0]
+	if len(qc.assigned) > 1 {
+		qc.assigned = qc.assigned[1:]
+	}
+	return assigned, nil
+}
+
+func TestObserverIsNotifiedOfAssignedAndRevokedPartitions(t *testing.T) {
+	observer := &recordingObserver{}
+	queue := &assigningQueueCaller{
+		scriptedQueueCaller: scriptedQueueCaller{fetches: [][]int{{0}, {}, {}}},
+		assigned: [][]TopicPartition{
+			{{Topic: "test", Partition: 0}, {Topic: "test", Partition: 1}},
+			{{Topic: "test", Partition: 1}, {Topic: "test", Partition: 2}},
+		},
+	}
+	c := &consumerInstance{config: QueueConfig{Observer: observer}, queue: queue, consumer: consInstTest,
+		processor: splitProcessor(func(m Message) {}), logger: log.NewUPPLogger("Test", "FATAL")}
+
+	_, err := c.consume()
+	assert.NoError(t, err)
+	assert.Contains(t, observer.recorded(), "assigned [{test 0} {test 1}]", "idle partitions should be reported")
+
+	_, err = c.consume()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, queue.requests, "the assignments should not be requested again before the interval")
+	observer.recorded()
+
+	c.assignCheck = time.Now().Add(-assignmentCheckInterval)
+	_, err = c.consume()
+	assert.NoError(t, err)
+	events := observer.recorded()
+	assert.Contains(t, events, "revoked [{test 0}]")
+	assert.Contains(t, events, "assigned [{test 2}]")
+}
+
+func TestObserverIsNotifiedOfFailures(t *testing.T) {
+	observer := &recordingObserver{}
+	c := &consumerInstance{
+		config: QueueConfig{Observer: observer, BackoffPeriod: 1}, queue: consumeMsgErrorQueueCaller{}, consumer: consInstTest,
+		shutdownChan: make(chan bool, 1), processor: splitProcessor(func(m Message) {}), logger: log.NewUPPLogger("Test", "FATAL"),
+	}
+	c.initiateShutdown()
+	c.consumeAndHandleMessages()
+	c.consumeWhileActive()
+
+	events := observer.recorded()
+	assert.Equal(t, "fetch failed: error while consuming", events[0])
+	assert.Equal(t, "backing off 1s", events[len(events)-2])
+	assert.Equal(t, "shut down ", events[len(events)-1])
+}
+
+func TestObserverIsNotifiedOfRecoveredPanics(t *testing.T) {
+	observer := &recordingObserver{}
+	c := &consumerInstance{
+		config: QueueConfig{Observer: observer}, queue: consumeMsgPanicQueueCaller{}, consumer: consInstTest,
+		processor: splitProcessor(func(m Message) {}), logger: log.NewUPPLogger("Test", "FATAL"),
+	}
+
+	c.consumeAndHandleMessages()
+
+	assert.Contains(t, observer.recorded(), "recovered Panic")
+}
+
+func TestAssignmentsAreNotRequestedWithoutObserver(t *testing.T) {
+	queue := &assigningQueueCaller{
+		scriptedQueueCaller: scriptedQueueCaller{fetches: [][]int{{0}}},
+		assigned:            [][]TopicPartition{{{Topic: "test", Partition: 0}}},
+	}
+	c := &consumerInstance{config: QueueConfig{}, queue: queue, consumer: consInstTest,
+		processor: splitProcessor(func(m Message) {}), logger: log.NewUPPLogger("Test", "FATAL")}
+
+	_, err := c.consume()
+	assert.NoError(t, err)
+	assert.Zero(t, queue.requests)
+}
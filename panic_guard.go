@@ -0,0 +1,146 @@
+package consumer
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+
+	log "github.com/Financial-Times/go-logger/v2"
+)
+
+// PanicPolicy decides what happens to the messages whose handler panicked
+type PanicPolicy int
+
+const (
+	// PanicSkip treats the messages as handled, so they are committed with the rest of their batch
+	PanicSkip PanicPolicy = iota
+	// PanicRetry hands the messages to the handler again after the backoff period.
+	// The stream stops like with PanicStop once the handler panicked PanicMaxAttempts times with them.
+	PanicRetry
+	// PanicStop stops the consumption of the stream without committing the messages,
+	// so they are redelivered once the consumer instance of the group is recreated
+	PanicStop
+)
+
+// HandlerPanic describes a panic recovered from the message handler
+type HandlerPanic struct {
+	// Messages holds the message, or the batch of messages, being handled
+	Messages []Message
+	// Positions holds the positions of the records of the messages, in the same order
+	Positions []PartitionOffset
+	// Recovered is the value the handler panicked with
+	Recovered interface{}
+	// Stack is the stack trace of the goroutine of the handler at the time of the panic
+	Stack []byte
+	// Attempt is the number of times the handler panicked with the messages, starting with 1
+	Attempt int
+}
+
+func (p HandlerPanic) Error() string {
+	return fmt.Sprintf("message handler panicked: %v", p.Recovered)
+}
+
+// default number of attempts at handling messages whose handler panics with PanicRetry
+const defaultPanicMaxAttempts = 5
+
+// PanicHandler is called with every panic recovered from the message handler.
+// It returns the policy for the messages being handled.
+type PanicHandler func(p HandlerPanic) PanicPolicy
+
+// panicGuard recovers the panics of the message handler of a consumer instance.
+// A nil panicGuard lets the panics through.
+type panicGuard struct {
+	handler     PanicHandler
+	maxAttempts int
+	//waits between the attempts, set by the consumer instance
+	backOff func()
+	logger  *log.UPPLogger
+	stopped atomic.Bool
+}
+
+func newPanicGuard(config QueueConfig, logger *log.UPPLogger) *panicGuard {
+	maxAttempts := defaultPanicMaxAttempts
+	if config.PanicMaxAttempts > 0 {
+		maxAttempts = config.PanicMaxAttempts
+	}
+	return &panicGuard{handler: config.PanicHandler, maxAttempts: maxAttempts, logger: logger}
+}
+
+// run calls handle with the messages, recovering its panics until the policy is not to retry or the attempts run out.
+// A skipped panic is reported as success, a stopping panic as a HandlerPanic error.
+func (g *panicGuard) run(msgs []delivery, handle func() error) error {
+	if g == nil {
+		return handle()
+	}
+	for attempt := 1; ; attempt++ {
+		p, err := g.try(handle)
+		if p == nil {
+			return err
+		}
+		p.Messages = messagesOf(msgs)
+		p.Positions = positionsOf(msgs)
+		p.Attempt = attempt
+		g.log(*p)
+
+		policy := PanicSkip
+		if g.handler != nil {
+			policy = g.handler(*p)
+		}
+		if policy == PanicRetry && attempt >= g.maxAttempts {
+			g.logger.WithField("attempts", attempt).Error("Stopping the consumption after the last attempt at handling the messages")
+			policy = PanicStop
+		}
+		switch policy {
+		case PanicRetry:
+			if g.backOff != nil {
+				g.backOff()
+			}
+			continue
+		case PanicStop:
+			g.stopped.Store(true)
+			return *p
+		default:
+			return nil
+		}
+	}
+}
+
+func (g *panicGuard) try(handle func() error) (p *HandlerPanic, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			p = &HandlerPanic{Recovered: r, Stack: debug.Stack()}
+		}
+	}()
+	return nil, handle()
+}
+
+func (g *panicGuard) log(p HandlerPanic) {
+	entry := g.logger.WithError(p).WithFields(map[string]interface{}{
+		"stack":   string(p.Stack),
+		"attempt": p.Attempt,
+	})
+	if len(p.Messages) == 1 {
+		m, position := p.Messages[0], p.Positions[0]
+		entry = entry.WithTransactionID(m.Headers[requestIDHeader]).WithFields(map[string]interface{}{
+			"headers":   m.Headers,
+			"topic":     position.Topic,
+			"partition": position.Partition,
+			"offset":    position.Offset,
+		})
+	} else {
+		entry = entry.WithField("messages", len(p.Messages))
+	}
+	entry.Error("Recovered from message handler panic")
+}
+
+// reset lets the consumption continue after a panic stopped it, once the consumer instance is recreated
+func (g *panicGuard) reset() {
+	if g != nil {
+		g.stopped.Store(false)
+	}
+}
+
+// stopping reports whether a panic stopped the consumption
+func (g *panicGuard) stopping() bool {
+	return g != nil && g.stopped.Load()
+}
@@ -0,0 +1,164 @@
+package consumer
+
+import (
+	"errors"
+	"testing"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPanicGuardSkipsByDefault(t *testing.T) {
+	g := newPanicGuard(QueueConfig{}, log.NewUPPLogger("Test", "FATAL"))
+
+	err := g.run(deliveriesTest[1:], func() error { panic(errors.New("handler failure")) })
+
+	assert.NoError(t, err)
+	assert.False(t, g.stopping())
+}
+
+func TestPanicGuardPassesPanicDetailsToHandler(t *testing.T) {
+	var recovered HandlerPanic
+	g := newPanicGuard(QueueConfig{PanicHandler: func(p HandlerPanic) PanicPolicy {
+		recovered = p
+		return PanicSkip
+	}}, log.NewUPPLogger("Test", "FATAL"))
+
+	assert.NoError(t, g.run(deliveriesTest[1:], func() error { panic("handler failure") }))
+
+	assert.Equal(t, msgsTest[1:], recovered.Messages)
+	assert.Equal(t, []PartitionOffset{{"test", 0, 1}}, recovered.Positions)
+	assert.Equal(t, "handler failure", recovered.Recovered)
+	assert.Equal(t, 1, recovered.Attempt)
+	assert.Contains(t, string(recovered.Stack), "TestPanicGuardPassesPanicDetailsToHandler")
+	assert.EqualError(t, recovered, "message handler panicked: handler failure")
+}
+
+func TestPanicGuardRetries(t *testing.T) {
+	g := newPanicGuard(QueueConfig{PanicHandler: func(p HandlerPanic) PanicPolicy {
+		return PanicRetry
+	}}, log.NewUPPLogger("Test", "FATAL"))
+
+	calls := 0
+	err := g.run(deliveriesTest, func() error {
+		calls++
+		if calls < 3 {
+			panic("handler failure")
+		}
+		return errors.New("handler error")
+	})
+
+	assert.EqualError(t, err, "handler error", "the result of the successful attempt should be returned")
+	assert.Equal(t, 3, calls)
+}
+
+func TestPanicGuardBacksOffBetweenRetries(t *testing.T) {
+	g := newPanicGuard(QueueConfig{PanicMaxAttempts: 3, PanicHandler: func(p HandlerPanic) PanicPolicy {
+		return PanicRetry
+	}}, log.NewUPPLogger("Test", "FATAL"))
+	backoffs := 0
+	g.backOff = func() { backoffs++ }
+
+	calls := 0
+	err := g.run(deliveriesTest, func() error {
+		calls++
+		panic("handler failure")
+	})
+
+	assert.IsType(t, HandlerPanic{}, err, "the stream should stop after the last attempt")
+	assert.True(t, g.stopping())
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 2, backoffs)
+}
+
+func TestPanicRetryBacksOffInConsumerInstance(t *testing.T) {
+	observer := &recordingObserver{}
+	config := QueueConfig{Observer: observer, BackoffPeriod: 1, PanicMaxAttempts: 2, PanicHandler: func(p HandlerPanic) PanicPolicy {
+		return PanicRetry
+	}}
+	c := newConsumerInstance(config, func(m Message) error { panic("handler failure") }, nil, defaultTestQueueCaller{}, decodeBinaryValue, log.NewUPPLogger("Test", "FATAL"))
+
+	c.processor.consume(deliveriesTest[:1]...)
+
+	assert.True(t, c.guard.stopping())
+	assert.Equal(t, []string{"backing off 1s"}, observer.recorded(), "the retry should wait for the backoff period")
+}
+
+func TestPanicGuardStops(t *testing.T) {
+	g := newPanicGuard(QueueConfig{PanicHandler: func(p HandlerPanic) PanicPolicy {
+		return PanicStop
+	}}, log.NewUPPLogger("Test", "FATAL"))
+
+	err := g.run(deliveriesTest, func() error { panic("handler failure") })
+
+	assert.IsType(t, HandlerPanic{}, err)
+	assert.True(t, g.stopping())
+}
+
+func TestNilPanicGuardLetsPanicsThrough(t *testing.T) {
+	var g *panicGuard
+
+	assert.Panics(t, func() { g.run(deliveriesTest, func() error { panic("handler failure") }) })
+	assert.False(t, g.stopping())
+}
+
+func TestPanicStopsConsumerInstanceWithoutCommit(t *testing.T) {
+	observer := &recordingObserver{}
+	config := QueueConfig{Observer: observer, PanicHandler: func(p HandlerPanic) PanicPolicy {
+		return PanicStop
+	}}
+	c := newConsumerInstance(config, func(m Message) error {
+		if m.Body == "[]" {
+			panic("handler failure")
+		}
+		return nil
+	}, nil, defaultTestQueueCaller{}, nil, log.NewUPPLogger("Test", "FATAL"))
+
+	c.consumeWhileActive()
+
+	events := observer.recorded()
+	assert.NotContains(t, events, "committed []")
+	assert.Contains(t, events, "destroyed /queue/consumergroup/instance-d")
+	assert.Equal(t, "shut down ", events[len(events)-1])
+	assert.Nil(t, c.consumer)
+	assert.EqualError(t, c.checkConnectivity(), "consumption stopped by a message handler panic; ")
+}
+
+func TestPanicStopIsResetWhenInstanceIsRecreated(t *testing.T) {
+	panicking := true
+	c := newConsumerInstance(QueueConfig{PanicHandler: func(p HandlerPanic) PanicPolicy {
+		return PanicStop
+	}}, func(m Message) error {
+		if panicking {
+			panic("handler failure")
+		}
+		return nil
+	}, nil, defaultTestQueueCaller{}, nil, log.NewUPPLogger("Test", "FATAL"))
+
+	_, err := c.consume()
+	assert.Error(t, err)
+	assert.Error(t, c.checkConnectivity())
+
+	panicking = false
+	_, err = c.consume()
+	assert.NoError(t, err)
+	assert.NoError(t, c.checkConnectivity(), "the recreated instance should consume again")
+}
+
+func TestPanicSkipCommitsBatch(t *testing.T) {
+	observer := &recordingObserver{}
+	var handled []Message
+	c := newConsumerInstance(QueueConfig{Observer: observer}, func(m Message) error {
+		if m.Body == "body" {
+			panic("handler failure")
+		}
+		handled = append(handled, m)
+		return nil
+	}, nil, defaultTestQueueCaller{}, nil, log.NewUPPLogger("Test", "FATAL"))
+
+	_, err := c.consume()
+
+	assert.NoError(t, err)
+	assert.Equal(t, msgsTest[1:], handled)
+	assert.Contains(t, observer.recorded(), "committed []")
+}
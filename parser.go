@@ -11,30 +11,130 @@ import (
 	log "github.com/Financial-Times/go-logger/v2"
 )
 
-//raw message
-type message struct {
-	Value     string `json:"value"` //base64 encoded
-	Partition int    `json:"partition"`
-	Offset    int    `json:"offset"`
+//Record is a raw record fetched by a consumer instance
+type Record struct {
+	Topic string `json:"topic"`
+	//value of the record, the FT message in the binary format and the JSON value in the json and avro formats
+	Value         []byte `json:"value"`
+	Partition     int    `json:"partition"`
+	Offset        int    `json:"offset"`
+	ValueSchemaID *int   `json:"value_schema_id,omitempty"`
+	Timestamp     int64  `json:"timestamp,omitempty"` //milliseconds since the epoch
+
+	//set when the value of the record could not be read, the record is skipped by the decoders
+	err error
+	//embedded format the value was consumed in, set for the recorded records
+	format string
+}
+
+// restRecord is a record in the shape returned by the records endpoint of the REST proxy
+type restRecord struct {
+	Topic         string          `json:"topic"`
+	Value         json.RawMessage `json:"value"` //base64 encoded string in binary format
+	Partition     int             `json:"partition"`
+	Offset        int             `json:"offset"`
+	ValueSchemaID *int            `json:"value_schema_id,omitempty"`
+	Timestamp     int64           `json:"timestamp,omitempty"`
+	Format        string          `json:"format,omitempty"` //set by the recorder only, the value is then base64 encoded
+}
+
+// record returns the Record of the embedded format, decoding the base64 value of the binary format
+func (r restRecord) record(format string) Record {
+	rec := Record{Topic: r.Topic, Value: []byte(r.Value), Partition: r.Partition, Offset: r.Offset, ValueSchemaID: r.ValueSchemaID, Timestamp: r.Timestamp}
+	if format != "" && format != BinaryFormat {
+		return rec
+	}
+	rec.Value = nil
+	var raw string
+	if err := json.Unmarshal(r.Value, &raw); err != nil {
+		rec.err = fmt.Errorf("error decoding binary value: %w", err)
+		return rec
+	}
+	rec.Value, rec.err = decodeBase64(raw)
+	return rec
+}
+
+// batch holds the messages of a records response and the offsets of the last record per partition
+type batch struct {
+	msgs    []delivery
+	offsets []PartitionOffset
+}
+
+func parseBatch(data []byte, format string, decode valueDecoder, logger *log.UPPLogger) (batch, error) {
+	records, err := parseFormatRecords(data, format)
+	if err != nil {
+		return batch{}, err
+	}
+	return decodeRecords(records, decode, logger)
+}
+
+// parseRecords parses a records response of the binary format
+func parseRecords(data []byte) ([]Record, error) {
+	return parseFormatRecords(data, BinaryFormat)
 }
 
-func parseResponse(data []byte, logger *log.UPPLogger) ([]Message, error) {
-	var resp []message
-	err := json.Unmarshal(data, &resp)
+// parseFormatRecords parses a records response of the embedded format
+func parseFormatRecords(data []byte, format string) ([]Record, error) {
+	var wire []restRecord
+	err := json.Unmarshal(data, &wire)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing json message %q: %w", data, err)
 	}
-	var msgs []Message
-	for _, m := range resp {
-		msg, err := parseMessage(m.Value, logger)
+	records := make([]Record, len(wire))
+	for i, r := range wire {
+		records[i] = r.record(format)
+	}
+	return records, nil
+}
+
+// decodeRecords decodes the records into messages, skipping the malformed ones.
+// It fails if the schema of a record cannot be resolved, so that no offset of the records is committed.
+func decodeRecords(records []Record, decode valueDecoder, logger *log.UPPLogger) (batch, error) {
+	var b batch
+	for _, m := range records {
+		position := PartitionOffset{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset}
+		msg, err := decode(m, logger)
+		var schemaErr *schemaError
+		if errors.As(err, &schemaErr) {
+			return batch{}, err
+		}
+		b.offsets = mergeOffsets(b.offsets, position)
 		if err != nil {
 			logger.WithError(err).Error("Error parsing message")
 			continue
 		}
 
-		msgs = append(msgs, msg)
+		b.msgs = append(b.msgs, delivery{Message: msg, position: position})
+	}
+	return b, nil
+}
+
+// mergeOffsets keeps the highest offset per topic partition
+func mergeOffsets(offsets []PartitionOffset, merged ...PartitionOffset) []PartitionOffset {
+	for _, m := range merged {
+		found := false
+		for i, o := range offsets {
+			if o.Topic == m.Topic && o.Partition == m.Partition {
+				if m.Offset > o.Offset {
+					offsets[i].Offset = m.Offset
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			offsets = append(offsets, m)
+		}
+	}
+	return offsets
+}
+
+func decodeBase64(raw string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding base64 value: %w", err)
 	}
-	return msgs, nil
+	return decoded, nil
 }
 
 // FT async msg format:
@@ -43,20 +143,16 @@ func parseResponse(data []byte, logger *log.UPPLogger) ([]Message, error) {
 // *(message-header CRLF)
 // CRLF
 // message-body
-func parseMessage(raw string, logger *log.UPPLogger) (m Message, err error) {
-	decoded, err := base64.StdEncoding.DecodeString(raw)
-	if err != nil {
-		return Message{}, fmt.Errorf("error decoding base64 value: %w", err)
-	}
-	doubleNewLineStartIndex, err := getHeaderSectionEndingIndex(string(decoded[:]))
+func parseFTMessage(decoded string, logger *log.UPPLogger) (m Message) {
+	doubleNewLineStartIndex, err := getHeaderSectionEndingIndex(decoded)
 	if err != nil {
 		doubleNewLineStartIndex = len(decoded)
 		logger.WithError(err).Warn("message with no message body")
 	}
 
-	m.Headers = parseHeaders(string(decoded[:doubleNewLineStartIndex]))
-	m.Body = strings.TrimSpace(string(decoded[doubleNewLineStartIndex:]))
-	return m, nil
+	m.Headers = parseHeaders(decoded[:doubleNewLineStartIndex])
+	m.Body = strings.TrimSpace(decoded[doubleNewLineStartIndex:])
+	return m
 }
 
 func getHeaderSectionEndingIndex(msg string) (int, error) {
@@ -0,0 +1,88 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultPrefetchBuffer = 1
+
+type fetchResult struct {
+	batch batch
+	err   error
+}
+
+// prefetcher fetches the batches of a consumer instance in the background,
+// so the next batch is already requested while the current one is processed.
+// It stops on the first error, which is delivered as the last result. Empty polls are not followed by a backoff,
+// the consumer instance backs off when it receives them, while the prefetcher waits for room in its buffer.
+type prefetcher struct {
+	results chan fetchResult
+	stopped chan struct{}
+	done    sync.WaitGroup
+	//result fetched when the prefetcher was stopped, before there was room for it in the buffer
+	unsent *fetchResult
+}
+
+func startPrefetcher(fetch func() (batch, error), bufferSize int) *prefetcher {
+	if bufferSize <= 0 {
+		bufferSize = defaultPrefetchBuffer
+	}
+	p := &prefetcher{
+		results: make(chan fetchResult, bufferSize),
+		stopped: make(chan struct{}),
+	}
+	p.done.Add(1)
+	go func() {
+		defer p.done.Done()
+		for {
+			b, err := fetch()
+			select {
+			case p.results <- fetchResult{b, err}:
+			case <-p.stopped:
+				p.unsent = &fetchResult{b, err}
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// next returns the oldest fetched batch, waiting for it if needed.
+// With a non-zero deadline, it returns an empty batch if none was fetched by then.
+func (p *prefetcher) next(deadline time.Time) (batch, error) {
+	if deadline.IsZero() {
+		r := <-p.results
+		return r.batch, r.err
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case r := <-p.results:
+		return r.batch, r.err
+	case <-timer.C:
+		return batch{}, nil
+	}
+}
+
+// stop terminates the background fetching, waits for the in-flight request to complete
+// and returns the fetched results which were not consumed yet
+func (p *prefetcher) stop() []fetchResult {
+	close(p.stopped)
+	p.done.Wait()
+	var buffered []fetchResult
+	for {
+		select {
+		case r := <-p.results:
+			buffered = append(buffered, r)
+		default:
+			if p.unsent != nil {
+				buffered = append(buffered, *p.unsent)
+			}
+			return buffered
+		}
+	}
+}
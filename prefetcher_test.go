@@ -0,0 +1,158 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefetchCommitsProcessedOffsetsInOrder(t *testing.T) {
+	queue := &prefetchTestQueueCaller{fetched: make(chan int, 10)}
+	var handled []Message
+	c := &consumerInstance{config: QueueConfig{Prefetch: true, PrefetchBuffer: 2}, queue: queue, consumer: consInstTest,
+		processor: splitProcessor(func(m Message) {
+			handled = append(handled, m)
+		}), logger: log.NewUPPLogger("Test", "FATAL")}
+
+	_, err := c.consume()
+	assert.NoError(t, err)
+	<-queue.fetched
+	<-queue.fetched
+	<-queue.fetched
+
+	_, err = c.consume()
+	assert.NoError(t, err)
+	c.shutdown()
+
+	assert.Len(t, handled, 2)
+	assert.Equal(t, [][]PartitionOffset{
+		{{Topic: "test", Partition: 0, Offset: 0}},
+		{{Topic: "test", Partition: 0, Offset: 1}},
+	}, queue.commits)
+}
+
+func TestPrefetchErrorRecreatesConsumerInstance(t *testing.T) {
+	c := &consumerInstance{config: QueueConfig{Prefetch: true}, queue: consumeMsgErrorQueueCaller{}, consumer: consInstTest,
+		processor: splitProcessor(func(m Message) {}), logger: log.NewUPPLogger("Test", "FATAL")}
+
+	_, err := c.consume()
+	assert.EqualError(t, err, "error while consuming")
+	assert.Nil(t, c.prefetcher)
+	assert.Nil(t, c.consumer)
+}
+
+func TestParseBatchOffsets(t *testing.T) {
+	data := []byte(`[{"topic":"a","value":"RlRNU0cvMS4wCgpib2R5Cg==","partition":0,"offset":7},` +
+		`{"topic":"a","value":"RlRNU0cvMS4wCgpib2R5Cg==","partition":1,"offset":3},` +
+		`{"topic":"a","value":"RlRNU0cvMS4wCgpib2R5Cg==","partition":0,"offset":8}]`)
+
+	b, err := parseBatch(data, BinaryFormat, decodeBinaryValue, log.NewUPPLogger("Test", "FATAL"))
+	assert.NoError(t, err)
+	assert.Len(t, b.msgs, 3)
+	assert.Equal(t, []PartitionOffset{{"a", 0, 8}, {"a", 1, 3}}, b.offsets)
+}
+
+//returns a single message with increasing offsets and records the committed offsets
+type prefetchTestQueueCaller struct {
+	defaultTestQueueCaller
+	mu      sync.Mutex
+	offset  int
+	fetched chan int
+	commits [][]PartitionOffset
+}
+
+func (qc *prefetchTestQueueCaller) consumeMessages(ctx context.Context, cInst consumerInstanceURI) ([]Record, error) {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	offset := qc.offset
+	qc.offset++
+	qc.fetched <- offset
+	return parseRecords([]byte("[" + offsetRecord(offset) + "]"))
+}
+
+func (qc *prefetchTestQueueCaller) commitOffsets(ctx context.Context, cInst consumerInstanceURI, offsets []PartitionOffset) error {
+	if len(offsets) == 0 {
+		return errors.New("all fetched offsets should not be committed while prefetching")
+	}
+	qc.commits = append(qc.commits, append([]PartitionOffset(nil), offsets...))
+	return nil
+}
+
+func TestFetchBatchAccumulatesMinBatchSize(t *testing.T) {
+	queue := &prefetchTestQueueCaller{fetched: make(chan int, 10)}
+	c := &consumerInstance{config: QueueConfig{MinBatchSize: 3}, queue: queue, consumer: consInstTest, logger: log.NewUPPLogger("Test", "FATAL")}
+
+	b, err := c.fetchBatch(time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, b.msgs, 3)
+	assert.Equal(t, []PartitionOffset{{"test", 0, 2}}, b.offsets)
+}
+
+func TestLongPollingSkipsEmptyPollBackoff(t *testing.T) {
+	c := &consumerInstance{config: QueueConfig{BackoffPeriod: 2}}
+	assert.Equal(t, 2*time.Second, c.emptyPollBackoffPeriod())
+
+	c.config.FetchTimeout = 1000
+	assert.Equal(t, time.Duration(0), c.emptyPollBackoffPeriod())
+	assert.Equal(t, 2*time.Second, c.backoffPeriod(), "errors should still be followed by the backoff period")
+}
+
+func TestPausingStopsPrefetchingAndKeepsFetchedBatches(t *testing.T) {
+	queue := &prefetchTestQueueCaller{fetched: make(chan int, 10)}
+	var handled []Message
+	c := &consumerInstance{config: QueueConfig{Prefetch: true}, queue: queue, consumer: consInstTest,
+		processor: splitProcessor(func(m Message) {
+			handled = append(handled, m)
+		}), logger: log.NewUPPLogger("Test", "FATAL")}
+
+	_, err := c.consume()
+	assert.NoError(t, err)
+	<-queue.fetched
+	<-queue.fetched
+	<-queue.fetched
+
+	c.pause()
+	c.stopPrefetching()
+	assert.Nil(t, c.prefetcher)
+	assert.Len(t, queue.fetched, 0, "no records should be fetched while paused")
+
+	c.resume()
+	for i := 0; i < 2; i++ {
+		_, err = c.consume()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []int{0, 1, 2}, offsetsOf(handled), "the batches fetched before pausing should be consumed")
+}
+
+func TestPrefetcherDoesNotBackOff(t *testing.T) {
+	var polls atomic.Int32
+	p := startPrefetcher(func() (batch, error) {
+		polls.Add(1)
+		return batch{}, nil
+	}, 1)
+	defer p.stop()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := p.next(time.Time{})
+		assert.NoError(t, err)
+	}
+	assert.Less(t, time.Since(start), time.Second, "empty polls should not be followed by a backoff")
+	assert.GreaterOrEqual(t, polls.Load(), int32(3))
+}
+
+func TestPrefetchDisablesAutoCommit(t *testing.T) {
+	config := QueueConfig{Addrs: []string{"http://localhost"}, Prefetch: true, AutoCommitEnable: true}
+	c := NewConsumer(config, func(m Message) {}, &http.Client{}, log.NewUPPLogger("Test", "FATAL")).(*Consumer)
+
+	instance := c.instanceHandlers[0].(*consumerInstance)
+	assert.False(t, instance.config.AutoCommitEnable, "the prefetched records should not be auto-committed before they are processed")
+	assert.False(t, instance.queue.(*kafkaRESTClient).autoCommitEnable)
+}
@@ -0,0 +1,128 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProxyFailureThreshold = 3
+	defaultProxyCoolDown         = 30
+)
+
+type addressState struct {
+	failures int
+	open     bool
+	probing  bool
+	since    time.Time
+}
+
+// proxyHealth tracks the health of the proxy addresses with a circuit breaker per address.
+// An address is skipped for the cool-down period after threshold consecutive failures,
+// then a single probe request is let through which closes the circuit on success.
+// It is shared by all the streams of a Consumer. A nil proxyHealth considers every address healthy.
+type proxyHealth struct {
+	threshold int
+	coolDown  time.Duration
+
+	mu        sync.Mutex
+	addresses map[string]*addressState
+}
+
+func newProxyHealth(config QueueConfig) *proxyHealth {
+	threshold := defaultProxyFailureThreshold
+	if config.ProxyFailureThreshold > 0 {
+		threshold = config.ProxyFailureThreshold
+	}
+	coolDown := defaultProxyCoolDown
+	if config.ProxyCoolDown > 0 {
+		coolDown = config.ProxyCoolDown
+	}
+	return &proxyHealth{
+		threshold: threshold,
+		coolDown:  time.Duration(coolDown) * time.Second,
+		addresses: make(map[string]*addressState),
+	}
+}
+
+// state must be called with the lock held
+func (h *proxyHealth) state(addr string) *addressState {
+	s, ok := h.addresses[addr]
+	if !ok {
+		s = &addressState{}
+		h.addresses[addr] = s
+	}
+	return s
+}
+
+// available reports whether requests can be sent to the address.
+// Once the cool-down period of an open circuit has elapsed, it lets through a single probe.
+func (h *proxyHealth) available(addr string) bool {
+	if h == nil {
+		return true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.state(addr)
+	if !s.open {
+		return true
+	}
+	if s.probing || time.Since(s.since) < h.coolDown {
+		return false
+	}
+	s.probing = true
+	return true
+}
+
+// report records the result of a request sent to the address
+func (h *proxyHealth) report(addr string, err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.state(addr)
+	if !isProxyFailure(err) {
+		*s = addressState{}
+		return
+	}
+	s.failures++
+	if s.open || s.failures >= h.threshold {
+		s.open = true
+		s.probing = false
+		s.since = time.Now()
+	}
+}
+
+// check returns an error describing the address if its circuit is open
+func (h *proxyHealth) check(addr string) error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.state(addr)
+	if !s.open {
+		return nil
+	}
+	return fmt.Errorf("proxy %s skipped since %s after %d consecutive failures", addr, s.since.Format(time.RFC3339), s.failures)
+}
+
+// isProxyFailure reports whether the error means the proxy is unhealthy.
+// Client errors, like requesting an expired consumer instance, do not count as failures.
+func isProxyFailure(err error) bool {
+	var credsErr *credentialsError
+	if errors.As(err, &credsErr) {
+		return false
+	}
+	var statusErr *unexpectedStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status >= 500
+	}
+	return err != nil
+}
@@ -0,0 +1,68 @@
+package consumer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyHealthOpensAfterThreshold(t *testing.T) {
+	h := newProxyHealth(QueueConfig{ProxyFailureThreshold: 2})
+
+	h.report("a", errors.New("connection refused"))
+	assert.True(t, h.available("a"))
+	assert.NoError(t, h.check("a"))
+
+	h.report("a", &unexpectedStatusError{503, 200})
+	assert.False(t, h.available("a"))
+	assert.Error(t, h.check("a"))
+	assert.True(t, h.available("b"))
+}
+
+func TestProxyHealthIgnoresClientErrors(t *testing.T) {
+	h := newProxyHealth(QueueConfig{ProxyFailureThreshold: 1})
+
+	h.report("a", &unexpectedStatusError{404, 200})
+
+	assert.True(t, h.available("a"))
+}
+
+func TestProxyHealthProbesAfterCoolDown(t *testing.T) {
+	h := newProxyHealth(QueueConfig{ProxyFailureThreshold: 1})
+	h.report("a", errors.New("timeout"))
+	h.addresses["a"].since = time.Now().Add(-h.coolDown)
+
+	assert.True(t, h.available("a"), "a single probe should be let through")
+	assert.False(t, h.available("a"), "only one probe should be let through")
+
+	h.report("a", errors.New("timeout"))
+	assert.False(t, h.available("a"), "a failed probe should restart the cool-down")
+
+	h.addresses["a"].since = time.Now().Add(-h.coolDown)
+	assert.True(t, h.available("a"))
+	h.report("a", nil)
+	assert.True(t, h.available("a"))
+	assert.NoError(t, h.check("a"))
+}
+
+func TestNilProxyHealth(t *testing.T) {
+	var h *proxyHealth
+
+	h.report("a", errors.New("timeout"))
+
+	assert.True(t, h.available("a"))
+	assert.NoError(t, h.check("a"))
+}
+
+func TestProbesAreNotReportedToProxyHealth(t *testing.T) {
+	health := newProxyHealth(QueueConfig{ProxyFailureThreshold: 1})
+	health.report("http://proxy-1", errors.New("connection refused"))
+	q := &kafkaRESTClient{addrs: []string{"http://proxy-1"}, group: "group", caller: &recordingHTTPCaller{}, health: health,
+		properties: ConsumerProperties{Name: "host-0"}, namedInstances: true}
+
+	q.destroyStaleConsumerInstance()
+	assert.Error(t, q.checkConnectivity(), "the successful probe should not close the breaker")
+	assert.False(t, health.available("http://proxy-1"))
+}
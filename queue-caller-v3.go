@@ -0,0 +1,217 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Versions of the REST proxy API
+const (
+	APIv2 = "v2"
+	APIv3 = "v3"
+)
+
+const v3ContentType = "application/json"
+
+var errNoClusters = errors.New("no kafka clusters found")
+
+// ErrNoGroupInspection is returned when inspecting the consumer group through a proxy API without support for it
+var ErrNoGroupInspection = errors.New("consumer group inspection requires APIVersion v3")
+
+// kafkaRESTv3Client uses the v3 API of the REST proxy where it is supported: cluster scoped topics,
+// producing records and inspecting consumer groups. The v3 API has no consumer instances,
+// so the consumption of messages is still done through the v2 API.
+type kafkaRESTv3Client struct {
+	*kafkaRESTClient
+
+	mu sync.Mutex
+	//resolved from the proxy when not configured
+	clusterID string
+}
+
+// ConsumerGroup is the state of a consumer group, as reported by the v3 API of the REST proxy
+type ConsumerGroup struct {
+	ID                string `json:"consumer_group_id"`
+	State             string `json:"state"`
+	PartitionAssignor string `json:"partition_assignor"`
+	IsSimple          bool   `json:"is_simple"`
+}
+
+// GroupConsumer is a member of a consumer group
+type GroupConsumer struct {
+	ConsumerID string `json:"consumer_id"`
+	InstanceID string `json:"instance_id"`
+	ClientID   string `json:"client_id"`
+}
+
+// groupCaller is implemented by the queue callers which can inspect the consumer group
+type groupCaller interface {
+	consumerGroup() (ConsumerGroup, error)
+	groupConsumers() ([]GroupConsumer, error)
+}
+
+func newKafkaRESTv3Client(q *kafkaRESTClient, clusterID string) *kafkaRESTv3Client {
+	return &kafkaRESTv3Client{kafkaRESTClient: q, clusterID: clusterID}
+}
+
+func (q *kafkaRESTv3Client) checkConnectivity() error {
+	if len(q.addrs) == 0 {
+		return ErrNoQueueAddresses
+	}
+
+	errMsg := ""
+	for _, address := range q.addrs {
+		if err := q.checkClusterReachable(address); err != nil {
+			errMsg = errMsg + err.Error() + "; "
+		}
+		if err := q.health.check(address); err != nil {
+			errMsg = errMsg + err.Error() + "; "
+		}
+	}
+	if errMsg != "" {
+		return errors.New(errMsg)
+	}
+	return nil
+}
+
+// checkReachable returns an error if none of the proxies is reachable, regardless of their health tracking
+func (q *kafkaRESTv3Client) checkReachable() error {
+	if len(q.addrs) == 0 {
+		return ErrNoQueueAddresses
+	}
+	errMsg := ""
+	for _, address := range q.addrs {
+		err := q.checkClusterReachable(address)
+		if err == nil {
+			return nil
+		}
+		errMsg = errMsg + err.Error() + "; "
+	}
+	return errors.New(errMsg)
+}
+
+func (q *kafkaRESTv3Client) checkClusterReachable(address string) error {
+	clusterURL, err := q.clusterURL(address, false)
+	if err != nil {
+		return fmt.Errorf("could not connect to proxy: %w", err)
+	}
+	_, err = q.caller.DoReq(context.Background(), "GET", clusterURL+"/topics", nil, map[string]string{"Accept": v3ContentType}, http.StatusOK)
+	if err != nil {
+		return fmt.Errorf("could not connect to proxy: %w", err)
+	}
+	return nil
+}
+
+// produceRecord writes a record with the given value and headers to the topic
+func (q *kafkaRESTv3Client) produceRecord(topic string, value []byte, headers map[string]string) error {
+	type data struct {
+		Type string `json:"type"`
+		Data string `json:"data"`
+	}
+	type header struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	record := struct {
+		Headers []header `json:"headers,omitempty"`
+		Value   data     `json:"value"`
+	}{Value: data{Type: "BINARY", Data: base64.StdEncoding.EncodeToString(value)}}
+	for k, v := range headers {
+		record.Headers = append(record.Headers, header{k, base64.StdEncoding.EncodeToString([]byte(v))})
+	}
+	reqBody, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshalling record: %w", err)
+	}
+
+	addr := q.addrs[q.addrInd]
+	clusterURL, err := q.clusterURL(addr, true)
+	if err != nil {
+		return err
+	}
+	_, err = q.doReq(context.Background(), addr, "POST", clusterURL+"/topics/"+url.PathEscape(topic)+"/records", bytes.NewReader(reqBody), map[string]string{"Content-Type": v3ContentType}, http.StatusOK)
+	return err
+}
+
+// consumerGroup returns the state of the consumer group
+func (q *kafkaRESTv3Client) consumerGroup() (g ConsumerGroup, err error) {
+	err = q.getGroupResource("", &g)
+	return g, err
+}
+
+// groupConsumers returns the members of the consumer group
+func (q *kafkaRESTv3Client) groupConsumers() ([]GroupConsumer, error) {
+	var list struct {
+		Data []GroupConsumer `json:"data"`
+	}
+	err := q.getGroupResource("/consumers", &list)
+	return list.Data, err
+}
+
+func (q *kafkaRESTv3Client) getGroupResource(path string, v interface{}) error {
+	addr := q.inspectionAddr()
+	clusterURL, err := q.clusterURL(addr, true)
+	if err != nil {
+		return err
+	}
+	data, err := q.doReq(context.Background(), addr, "GET", clusterURL+"/consumer-groups/"+url.PathEscape(q.group)+path, nil, map[string]string{"Accept": v3ContentType}, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error unmarshalling json content: %w", err)
+	}
+	return nil
+}
+
+// inspectionAddr returns the first healthy address, or the first one if none is.
+// The group is inspected from the goroutines of the callers, so the address of the consumer instance,
+// changed by the stream, is not used.
+func (q *kafkaRESTv3Client) inspectionAddr() string {
+	for _, addr := range q.addrs {
+		if q.health.available(addr) {
+			return addr
+		}
+	}
+	return q.addrs[0]
+}
+
+// clusterURL returns the v3 URL of the configured cluster, resolving the ID of the first cluster of the proxy if not configured.
+// The resolution is reported to the health tracking of the address only if tracked, so that probes do not affect it.
+func (q *kafkaRESTv3Client) clusterURL(address string, tracked bool) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.clusterID == "" {
+		var data []byte
+		var err error
+		if tracked {
+			data, err = q.doReq(context.Background(), address, "GET", address+"/v3/clusters", nil, map[string]string{"Accept": v3ContentType}, http.StatusOK)
+		} else {
+			data, err = q.caller.DoReq(context.Background(), "GET", address+"/v3/clusters", nil, map[string]string{"Accept": v3ContentType}, http.StatusOK)
+		}
+		if err != nil {
+			return "", fmt.Errorf("error resolving cluster ID: %w", err)
+		}
+		var list struct {
+			Data []struct {
+				ClusterID string `json:"cluster_id"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return "", fmt.Errorf("error unmarshalling json content: %w", err)
+		}
+		if len(list.Data) == 0 {
+			return "", errNoClusters
+		}
+		q.clusterID = list.Data[0].ClusterID
+	}
+	return address + "/v3/clusters/" + url.PathEscape(q.clusterID), nil
+}
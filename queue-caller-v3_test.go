@@ -0,0 +1,162 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	logger "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupMockKafkaV3(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v3/clusters":
+			_, _ = w.Write([]byte(`{"data": [{"cluster_id": "cluster-1"}, {"cluster_id": "cluster-2"}]}`))
+		case "/v3/clusters/cluster-1/topics":
+			_, _ = w.Write([]byte(`{"data": [{"topic_name": "methode-articles"}]}`))
+		case "/v3/clusters/cluster-1/consumer-groups/mcpm-group":
+			_, _ = w.Write([]byte(`{"consumer_group_id": "mcpm-group", "state": "STABLE", "partition_assignor": "range"}`))
+		case "/v3/clusters/cluster-1/consumer-groups/mcpm-group/consumers":
+			_, _ = w.Write([]byte(`{"data": [{"consumer_id": "consumer-1", "instance_id": "host-0", "client_id": "client-1"}]}`))
+		case "/v3/clusters/cluster-1/topics/dead-letters/records":
+			assert.Equal(t, "POST", req.Method)
+			var record map[string]interface{}
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&record))
+			assert.Equal(t, map[string]interface{}{"type": "BINARY", "data": "Ym9keQ=="}, record["value"])
+			assert.Equal(t, []interface{}{map[string]interface{}{"name": "Message-Id", "value": "MDAwMA=="}}, record["headers"])
+			_, _ = w.Write([]byte(`{"error_code": 200}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+		assert.Equal(t, "my-first-auth-key", req.Header.Get("Authorization"))
+	}))
+}
+
+func TestV3ConnectivityCheck(t *testing.T) {
+	proxy := setupMockKafkaV3(t)
+	defer proxy.Close()
+
+	config := consumerConfigMock
+	config.Addrs = []string{proxy.URL}
+	config.APIVersion = APIv3
+	c := NewConsumer(config, func(m Message) {}, &http.Client{}, logger.NewUPPLogger("Test", "FATAL"))
+	msg, err := c.ConnectivityCheck()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Connectivity to consumer proxies is OK.", msg)
+}
+
+func TestV3ConnectivityCheckUnknownCluster(t *testing.T) {
+	proxy := setupMockKafkaV3(t)
+	defer proxy.Close()
+
+	config := consumerConfigMock
+	config.Addrs = []string{proxy.URL}
+	config.APIVersion = APIv3
+	config.ClusterID = "cluster-3"
+	c := NewConsumer(config, func(m Message) {}, &http.Client{}, logger.NewUPPLogger("Test", "FATAL"))
+	_, err := c.ConnectivityCheck()
+
+	assert.EqualError(t, err, "could not connect to proxy: unexpected response status 404. Expected: 200; ")
+}
+
+func TestV3ConsumerGroupInspection(t *testing.T) {
+	proxy := setupMockKafkaV3(t)
+	defer proxy.Close()
+
+	config := consumerConfigMock
+	config.Addrs = []string{proxy.URL}
+	q := newKafkaRESTv3Client(newKafkaRESTClient(config, &http.Client{}), "")
+
+	group, err := q.consumerGroup()
+	assert.NoError(t, err)
+	assert.Equal(t, ConsumerGroup{ID: "mcpm-group", State: "STABLE", PartitionAssignor: "range"}, group)
+
+	consumers, err := q.groupConsumers()
+	assert.NoError(t, err)
+	assert.Equal(t, []GroupConsumer{{ConsumerID: "consumer-1", InstanceID: "host-0", ClientID: "client-1"}}, consumers)
+}
+
+func TestV3ProduceRecord(t *testing.T) {
+	proxy := setupMockKafkaV3(t)
+	defer proxy.Close()
+
+	config := consumerConfigMock
+	config.Addrs = []string{proxy.URL}
+	q := newKafkaRESTv3Client(newKafkaRESTClient(config, &http.Client{}), "cluster-1")
+
+	err := q.produceRecord("dead-letters", []byte("body"), map[string]string{"Message-Id": "0000"})
+	assert.NoError(t, err)
+}
+
+func TestV3ConsumesThroughV2(t *testing.T) {
+	caller := &recordingHTTPCaller{response: "[]"}
+	q := newKafkaRESTv3Client(&kafkaRESTClient{addrs: []string{"http://kafka-proxy"}, caller: caller}, "cluster-1")
+
+	_, err := q.consumeMessages(context.Background(), testConsumer)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://kafka-proxy/consumers/group1/instances/rest-consumer-1-45864/records", caller.addr)
+}
+
+func TestConsumerGroupInspectionThroughConsumer(t *testing.T) {
+	proxy := setupMockKafkaV3(t)
+	defer proxy.Close()
+
+	config := consumerConfigMock
+	config.Addrs = []string{proxy.URL}
+	config.APIVersion = APIv3
+	c := NewConsumer(config, func(m Message) {}, &http.Client{}, logger.NewUPPLogger("Test", "FATAL")).(*Consumer)
+
+	group, err := c.ConsumerGroup()
+	assert.NoError(t, err)
+	assert.Equal(t, "STABLE", group.State)
+	consumers, err := c.GroupConsumers()
+	assert.NoError(t, err)
+	assert.Len(t, consumers, 1)
+
+	config.APIVersion = APIv2
+	c = NewConsumer(config, func(m Message) {}, &http.Client{}, logger.NewUPPLogger("Test", "FATAL")).(*Consumer)
+	_, err = c.ConsumerGroup()
+	assert.Equal(t, ErrNoGroupInspection, err)
+}
+
+func TestV3ConsumerGroupInspectionWhileCreatingInstances(t *testing.T) {
+	proxy := setupMockKafkaV3(t)
+	defer proxy.Close()
+
+	config := consumerConfigMock
+	config.Addrs = []string{proxy.URL, proxy.URL}
+	q := newKafkaRESTv3Client(newKafkaRESTClient(config, &http.Client{}), "cluster-1")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			_, _ = q.createConsumerInstance()
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		_, err := q.consumerGroup()
+		assert.NoError(t, err)
+	}
+	<-done
+}
+
+func TestV3ConnectivityCheckDoesNotReportToHealth(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer proxy.Close()
+
+	config := consumerConfigMock
+	config.Addrs = []string{proxy.URL}
+	q := newKafkaRESTv3Client(newKafkaRESTClient(config, &http.Client{}), "")
+	q.health = newProxyHealth(QueueConfig{ProxyFailureThreshold: 1})
+
+	assert.Error(t, q.checkConnectivity())
+	assert.True(t, q.health.available(proxy.URL), "the failed probe should not open the breaker of the address")
+}
@@ -1,6 +1,8 @@
 package consumer
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +11,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var ErrNoQueueAddresses = errors.New("no kafka-rest-proxy addresses configured")
@@ -16,7 +19,7 @@ var ErrNoQueueAddresses = errors.New("no kafka-rest-proxy addresses configured")
 const msgContentType = "application/vnd.kafka.v2+json"
 
 type httpCaller interface {
-	DoReq(method, addr string, body io.Reader, headers map[string]string, expectedStatus int) ([]byte, error)
+	DoReq(ctx context.Context, method, addr string, body io.Reader, headers map[string]string, expectedStatus int) ([]byte, error)
 }
 
 type kafkaRESTClient struct {
@@ -31,14 +34,30 @@ type kafkaRESTClient struct {
 	offset           string
 	caller           httpCaller
 	autoCommitEnable bool
+	properties       ConsumerProperties
+	//whether the instance name is unique to the stream and host, so a stale instance with it can be deleted
+	namedInstances bool
+	//maximum time in milliseconds the proxy waits for records, 0 uses the proxy default
+	fetchTimeout int
+	//maximum size in bytes of the records returned by a request, 0 uses the proxy default
+	fetchMaxBytes int
+	//circuit breakers of the addresses, shared by the streams of a consumer
+	health *proxyHealth
 }
 
 func (q *kafkaRESTClient) createConsumerInstance() (c consumerInstanceURI, err error) {
-	q.addrInd = (q.addrInd + 1) % len(q.addrs)
+	q.addrInd = q.nextAddrInd()
 	addr := q.addrs[q.addrInd]
 
-	reqBody := strings.NewReader(`{"auto.offset.reset": "` + q.offset + `", "auto.commit.enable": "` + strconv.FormatBool(q.autoCommitEnable) + `"}`)
-	data, err := q.caller.DoReq("POST", addr+"/consumers/"+q.group, reqBody, map[string]string{"Content-Type": msgContentType}, http.StatusOK)
+	if q.namedInstances && q.properties.Name != "" {
+		q.destroyStaleConsumerInstance()
+	}
+
+	reqBody, err := json.Marshal(q.properties.request(q.offset, q.autoCommitEnable))
+	if err != nil {
+		return consumerInstanceURI{}, fmt.Errorf("error marshalling consumer properties: %w", err)
+	}
+	data, err := q.doReq(context.Background(), addr, "POST", addr+"/consumers/"+q.group, bytes.NewReader(reqBody), map[string]string{"Content-Type": msgContentType}, http.StatusOK)
 	if err != nil {
 		return consumerInstanceURI{}, err
 	}
@@ -50,13 +69,41 @@ func (q *kafkaRESTClient) createConsumerInstance() (c consumerInstanceURI, err e
 	return
 }
 
+// nextAddrInd returns the index of the next healthy address in round-robin order.
+// If no address is healthy, it returns the next one regardless.
+func (q *kafkaRESTClient) nextAddrInd() int {
+	for i := 1; i <= len(q.addrs); i++ {
+		ind := (q.addrInd + i) % len(q.addrs)
+		if q.health.available(q.addrs[ind]) {
+			return ind
+		}
+	}
+	return (q.addrInd + 1) % len(q.addrs)
+}
+
+// doReq sends the request and reports its result to the health tracking of the address
+func (q *kafkaRESTClient) doReq(ctx context.Context, addr, method, url string, body io.Reader, headers map[string]string, expectedStatus int) ([]byte, error) {
+	data, err := q.caller.DoReq(ctx, method, url, body, headers, expectedStatus)
+	q.health.report(addr, err)
+	return data, err
+}
+
+// destroyStaleConsumerInstance deletes the consumer instance with the configured name from all the proxies.
+// Such an instance is left behind when the consumer could not shut down cleanly, and it holds partitions until it expires.
+// Failures are ignored as the instance usually does not exist, and are not reported to the health tracking.
+func (q *kafkaRESTClient) destroyStaleConsumerInstance() {
+	for _, addr := range q.addrs {
+		_, _ = q.caller.DoReq(context.Background(), "DELETE", addr+"/consumers/"+q.group+"/instances/"+url.PathEscape(q.properties.Name), nil, map[string]string{"Accept": msgContentType}, http.StatusNoContent)
+	}
+}
+
 func (q *kafkaRESTClient) destroyConsumerInstance(c consumerInstanceURI) (err error) {
 	url, err := q.buildConsumerURL(c)
 	if err != nil {
 		return fmt.Errorf("error building consumer URL: %w", err)
 	}
 
-	_, err = q.caller.DoReq("DELETE", url.String(), nil, map[string]string{"Accept": msgContentType}, http.StatusNoContent)
+	_, err = q.doReq(context.Background(), q.addrs[q.addrInd], "DELETE", url.String(), nil, map[string]string{"Accept": msgContentType}, http.StatusNoContent)
 	return err
 }
 
@@ -68,7 +115,7 @@ func (q *kafkaRESTClient) subscribeConsumerInstance(c consumerInstanceURI) (err
 
 	url.Path = strings.TrimRight(url.Path, "/") + "/subscription"
 	reqBody := strings.NewReader(`{"topics": ["` + q.topic + `"]}`)
-	_, err = q.caller.DoReq("POST", url.String(), reqBody, map[string]string{"Content-Type": msgContentType}, http.StatusNoContent)
+	_, err = q.doReq(context.Background(), q.addrs[q.addrInd], "POST", url.String(), reqBody, map[string]string{"Content-Type": msgContentType}, http.StatusNoContent)
 	if err != nil {
 		return err
 	}
@@ -83,33 +130,90 @@ func (q *kafkaRESTClient) destroyConsumerInstanceSubscription(c consumerInstance
 	}
 
 	url.Path = strings.TrimRight(url.Path, "/") + "/subscription"
-	_, err = q.caller.DoReq("DELETE", url.String(), nil, map[string]string{"Accept": msgContentType}, http.StatusNoContent)
+	_, err = q.doReq(context.Background(), q.addrs[q.addrInd], "DELETE", url.String(), nil, map[string]string{"Accept": msgContentType}, http.StatusNoContent)
 	return err
 }
 
-func (q *kafkaRESTClient) consumeMessages(c consumerInstanceURI) ([]byte, error) {
+// keepAliveConsumerInstance performs a cheap read of the instance subscription.
+// Any request against the consumer instance resets its expiration timeout on the proxy.
+func (q *kafkaRESTClient) keepAliveConsumerInstance(c consumerInstanceURI) error {
+	url, err := q.buildConsumerURL(c)
+	if err != nil {
+		return fmt.Errorf("error building consumer URL: %w", err)
+	}
+
+	url.Path = strings.TrimRight(url.Path, "/") + "/subscription"
+	_, err = q.doReq(context.Background(), q.addrs[q.addrInd], "GET", url.String(), nil, map[string]string{"Accept": msgContentType}, http.StatusOK)
+	return err
+}
+
+func (q *kafkaRESTClient) consumeMessages(ctx context.Context, c consumerInstanceURI) ([]Record, error) {
 	uri, err := q.buildConsumerURL(c)
 	if err != nil {
 		return nil, fmt.Errorf("error building consumer URL: %w", err)
 	}
 
 	uri.Path = strings.TrimRight(uri.Path, "/") + "/records"
-	data, err := q.caller.DoReq("GET", uri.String(), nil, map[string]string{"Accept": msgContentType}, http.StatusOK)
+	query := url.Values{}
+	if timeout := fetchTimeout(ctx, q.fetchTimeout); timeout > 0 {
+		query.Set("timeout", strconv.Itoa(timeout))
+	}
+	if q.fetchMaxBytes > 0 {
+		query.Set("max_bytes", strconv.Itoa(q.fetchMaxBytes))
+	}
+	uri.RawQuery = query.Encode()
+	data, err := q.doReq(ctx, q.addrs[q.addrInd], "GET", uri.String(), nil, map[string]string{"Accept": recordsContentType(q.properties.Format)}, http.StatusOK)
 	if err != nil {
 		return nil, err
 	}
 
-	return data, nil
+	return parseFormatRecords(data, q.properties.Format)
+}
+
+type fetchTimeoutKey struct{}
+
+// withFetchTimeout caps the timeout of the records requests made with the context, so long polls end by the deadline
+func withFetchTimeout(ctx context.Context, deadline time.Time) context.Context {
+	return context.WithValue(ctx, fetchTimeoutKey{}, deadline)
+}
+
+// fetchTimeout returns the timeout in milliseconds of a records request, capped by the deadline of the context
+func fetchTimeout(ctx context.Context, timeout int) int {
+	deadline, ok := ctx.Value(fetchTimeoutKey{}).(time.Time)
+	if !ok || timeout <= 0 {
+		return timeout
+	}
+	remaining := int((time.Until(deadline) + time.Millisecond - 1) / time.Millisecond)
+	if remaining < 1 {
+		remaining = 1
+	}
+	if remaining < timeout {
+		return remaining
+	}
+	return timeout
 }
 
-func (q *kafkaRESTClient) commitOffsets(c consumerInstanceURI) (err error) {
+// commitOffsets commits the given offsets of the consumer instance.
+// If no offsets are given, all the records fetched by the consumer instance are committed.
+func (q *kafkaRESTClient) commitOffsets(ctx context.Context, c consumerInstanceURI, offsets []PartitionOffset) (err error) {
 	url, err := q.buildConsumerURL(c)
 	if err != nil {
 		return fmt.Errorf("error building consumer URL: %w", err)
 	}
 
+	var reqBody io.Reader
+	if len(offsets) > 0 {
+		data, err := json.Marshal(struct {
+			Offsets []PartitionOffset `json:"offsets"`
+		}{offsets})
+		if err != nil {
+			return fmt.Errorf("error marshalling offsets: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
 	url.Path = strings.TrimRight(url.Path, "/") + "/offsets"
-	_, err = q.caller.DoReq("POST", url.String(), nil, map[string]string{"Content-Type": msgContentType}, http.StatusOK)
+	_, err = q.doReq(ctx, q.addrs[q.addrInd], "POST", url.String(), reqBody, map[string]string{"Content-Type": msgContentType}, http.StatusOK)
 
 	return err
 }
@@ -145,6 +249,9 @@ func (q *kafkaRESTClient) checkConnectivity() error {
 		if err := q.checkMessageQueueProxyReachable(address); err != nil {
 			errMsg = errMsg + err.Error() + "; "
 		}
+		if err := q.health.check(address); err != nil {
+			errMsg = errMsg + err.Error() + "; "
+		}
 	}
 	if errMsg != "" {
 		return errors.New(errMsg)
@@ -152,8 +259,26 @@ func (q *kafkaRESTClient) checkConnectivity() error {
 	return nil
 }
 
+// checkReachable returns an error if none of the proxies is reachable, regardless of their health tracking
+func (q *kafkaRESTClient) checkReachable() error {
+	if len(q.addrs) == 0 {
+		return ErrNoQueueAddresses
+	}
+	errMsg := ""
+	for _, address := range q.addrs {
+		err := q.checkMessageQueueProxyReachable(address)
+		if err == nil {
+			return nil
+		}
+		errMsg = errMsg + err.Error() + "; "
+	}
+	return errors.New(errMsg)
+}
+
+// checkMessageQueueProxyReachable probes the proxy. The result is not reported to the health tracking,
+// so health checks do not close the circuit breaker of a failing address.
 func (q *kafkaRESTClient) checkMessageQueueProxyReachable(address string) error {
-	_, err := q.caller.DoReq("GET", address+"/topics", nil, map[string]string{"Accept": msgContentType}, http.StatusOK)
+	_, err := q.caller.DoReq(context.Background(), "GET", address+"/topics", nil, map[string]string{"Accept": msgContentType}, http.StatusOK)
 	if err != nil {
 		return fmt.Errorf("could not connect to proxy: %w", err)
 	}
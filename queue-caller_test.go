@@ -1,9 +1,12 @@
 package consumer
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -110,7 +113,7 @@ var testConsumer = consumerInstanceURI{
 type testHTTPCaller struct {
 }
 
-func (t testHTTPCaller) DoReq(method, addr string, body io.Reader, headers map[string]string, expectedStatus int) ([]byte, error) {
+func (t testHTTPCaller) DoReq(ctx context.Context, method, addr string, body io.Reader, headers map[string]string, expectedStatus int) ([]byte, error) {
 	_, err := url.Parse(addr)
 	return []byte("{}"), err
 }
@@ -121,3 +124,153 @@ func TestNoQueueAddressesFails(t *testing.T) {
 
 	assert.EqualError(t, err, ErrNoQueueAddresses.Error())
 }
+
+type recordingHTTPCaller struct {
+	response string
+	method   string
+	addr     string
+	body     string
+	calls    []string
+}
+
+func (r *recordingHTTPCaller) DoReq(ctx context.Context, method, addr string, body io.Reader, headers map[string]string, expectedStatus int) ([]byte, error) {
+	r.method, r.addr = method, addr
+	r.calls = append(r.calls, method+" "+addr)
+	if body != nil {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		r.body = string(data)
+	}
+	if r.response != "" {
+		return []byte(r.response), nil
+	}
+	return []byte("{}"), nil
+}
+
+func TestCommitOffsets(t *testing.T) {
+	caller := &recordingHTTPCaller{}
+	q := kafkaRESTClient{addrs: []string{"http://kafka-proxy"}, caller: caller}
+
+	err := q.commitOffsets(context.Background(), testConsumer, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://kafka-proxy/consumers/group1/instances/rest-consumer-1-45864/offsets", caller.addr)
+	assert.Empty(t, caller.body)
+
+	err = q.commitOffsets(context.Background(), testConsumer, []PartitionOffset{{"topic", 1, 42}})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"offsets":[{"topic":"topic","partition":1,"offset":42}]}`, caller.body)
+}
+
+func TestConsumeMessagesFetchParameters(t *testing.T) {
+	caller := &recordingHTTPCaller{response: "[]"}
+	q := kafkaRESTClient{addrs: []string{"http://kafka-proxy"}, caller: caller}
+
+	_, err := q.consumeMessages(context.Background(), testConsumer)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://kafka-proxy/consumers/group1/instances/rest-consumer-1-45864/records", caller.addr)
+
+	q.fetchTimeout = 30000
+	q.fetchMaxBytes = 1048576
+	_, err = q.consumeMessages(context.Background(), testConsumer)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://kafka-proxy/consumers/group1/instances/rest-consumer-1-45864/records?max_bytes=1048576&timeout=30000", caller.addr)
+
+	_, err = q.consumeMessages(withFetchTimeout(context.Background(), time.Now().Add(500*time.Millisecond)), testConsumer)
+	assert.NoError(t, err)
+	assert.Contains(t, caller.addr, "timeout=5", "the timeout should be capped by the deadline")
+	assert.NotContains(t, caller.addr, "timeout=30000")
+}
+
+func TestFetchTimeout(t *testing.T) {
+	assert.Equal(t, 0, fetchTimeout(withFetchTimeout(context.Background(), time.Now().Add(time.Second)), 0), "long polling should stay disabled")
+	assert.Equal(t, 1000, fetchTimeout(context.Background(), 1000))
+	assert.Equal(t, 1000, fetchTimeout(withFetchTimeout(context.Background(), time.Now().Add(time.Hour)), 1000))
+	assert.Equal(t, 1, fetchTimeout(withFetchTimeout(context.Background(), time.Now().Add(-time.Second)), 1000))
+}
+
+func TestCreateConsumerInstanceProperties(t *testing.T) {
+	caller := &recordingHTTPCaller{}
+	q := kafkaRESTClient{addrs: []string{"http://kafka-proxy"}, group: "group1", offset: "latest", caller: caller}
+
+	_, err := q.createConsumerInstance()
+	assert.NoError(t, err)
+	assert.Equal(t, "http://kafka-proxy/consumers/group1", caller.addr)
+	assert.JSONEq(t, `{"auto.offset.reset": "latest", "auto.commit.enable": "false"}`, caller.body)
+
+	q.autoCommitEnable = true
+	q.properties = ConsumerProperties{
+		Name:                 "instance-1",
+		Format:               "binary",
+		FetchMinBytes:        1024,
+		RequestTimeoutMs:     5000,
+		AutoCommitIntervalMs: 1000,
+		Extra:                map[string]string{"max.poll.records": "100", "auto.offset.reset": "earliest"},
+	}
+	_, err = q.createConsumerInstance()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"name": "instance-1",
+		"format": "binary",
+		"fetch.min.bytes": 1024,
+		"consumer.request.timeout.ms": 5000,
+		"auto.commit.interval.ms": 1000,
+		"max.poll.records": "100",
+		"auto.offset.reset": "latest",
+		"auto.commit.enable": "true"
+	}`, caller.body)
+}
+
+func TestCreateNamedConsumerInstanceDestroysStaleInstance(t *testing.T) {
+	caller := &recordingHTTPCaller{}
+	q := kafkaRESTClient{addrs: []string{"http://kafka-proxy-1", "http://kafka-proxy-2"}, group: "group1", caller: caller,
+		properties: ConsumerProperties{Name: "host-0"}, namedInstances: true}
+
+	_, err := q.createConsumerInstance()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"DELETE http://kafka-proxy-1/consumers/group1/instances/host-0",
+		"DELETE http://kafka-proxy-2/consumers/group1/instances/host-0",
+		"POST http://kafka-proxy-2/consumers/group1",
+	}, caller.calls)
+}
+
+func TestCreateConsumerInstanceWithFixedNameKeepsExistingInstances(t *testing.T) {
+	caller := &recordingHTTPCaller{}
+	q := kafkaRESTClient{addrs: []string{"http://kafka-proxy-1"}, group: "group1", caller: caller,
+		properties: ConsumerProperties{Name: "writer"}}
+
+	_, err := q.createConsumerInstance()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"POST http://kafka-proxy-1/consumers/group1"}, caller.calls,
+		"an instance with a name shared by streams and replicas may belong to a live consumer")
+}
+
+func TestCreateConsumerInstanceSkipsUnhealthyAddresses(t *testing.T) {
+	caller := &recordingHTTPCaller{response: `{"base_uri":"uri"}`}
+	health := newProxyHealth(QueueConfig{ProxyFailureThreshold: 1})
+	health.report("http://proxy-2", errors.New("connection refused"))
+	q := &kafkaRESTClient{addrs: []string{"http://proxy-1", "http://proxy-2", "http://proxy-3"}, group: "group", caller: caller, health: health}
+
+	_, err := q.createConsumerInstance()
+	assert.NoError(t, err)
+	assert.Equal(t, "http://proxy-3/consumers/group", caller.addr)
+
+	_, err = q.createConsumerInstance()
+	assert.NoError(t, err)
+	assert.Equal(t, "http://proxy-1/consumers/group", caller.addr)
+}
+
+func TestCreateConsumerInstanceFallsBackWhenNoAddressIsHealthy(t *testing.T) {
+	caller := &recordingHTTPCaller{response: `{"base_uri":"uri"}`}
+	health := newProxyHealth(QueueConfig{ProxyFailureThreshold: 1})
+	health.report("http://proxy-1", errors.New("connection refused"))
+	health.report("http://proxy-2", errors.New("connection refused"))
+	q := &kafkaRESTClient{addrs: []string{"http://proxy-1", "http://proxy-2"}, group: "group", caller: caller, health: health}
+
+	_, err := q.createConsumerInstance()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "http://proxy-2/consumers/group", caller.addr)
+}
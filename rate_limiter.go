@@ -0,0 +1,56 @@
+package consumer
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket limiting the number of messages handed to the handler per second.
+// A nil rateLimiter does not limit anything.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a rateLimiter for the configured rate, or nil if rate limiting is disabled
+func newRateLimiter(config QueueConfig) *rateLimiter {
+	if config.RateLimit <= 0 {
+		return nil
+	}
+	burst := float64(config.RateLimitBurst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(config.RateLimit))
+	}
+	return &rateLimiter{
+		rate:   config.RateLimit,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until n messages can be handled.
+// The tokens are reserved immediately, so a batch larger than the burst waits proportionally longer
+// and concurrent callers are served in the order of their calls.
+func (l *rateLimiter) wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	deficit := -l.tokens
+	l.mu.Unlock()
+
+	if deficit > 0 {
+		time.Sleep(time.Duration(deficit / l.rate * float64(time.Second)))
+	}
+}
@@ -0,0 +1,33 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterDisabled(t *testing.T) {
+	l := newRateLimiter(QueueConfig{})
+	assert.Nil(t, l)
+
+	start := time.Now()
+	l.wait(1000)
+	assert.True(t, time.Since(start) < 10*time.Millisecond)
+}
+
+func TestRateLimiterAllowsBurstThenLimits(t *testing.T) {
+	l := newRateLimiter(QueueConfig{RateLimit: 50, RateLimitBurst: 5})
+
+	start := time.Now()
+	l.wait(5)
+	assert.True(t, time.Since(start) < 10*time.Millisecond, "a burst should not be limited")
+
+	l.wait(5)
+	assert.True(t, time.Since(start) >= 90*time.Millisecond, "5 messages over the burst should wait 100ms at 50 msg/s")
+}
+
+func TestRateLimiterDefaultBurst(t *testing.T) {
+	assert.Equal(t, float64(3), newRateLimiter(QueueConfig{RateLimit: 2.5}).burst)
+	assert.Equal(t, float64(1), newRateLimiter(QueueConfig{RateLimit: 0.1}).burst)
+}
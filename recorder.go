@@ -0,0 +1,214 @@
+package consumer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Financial-Times/go-logger/v2"
+)
+
+const (
+	defaultRecordMaxBytes = 100 * 1024 * 1024
+	defaultRecordMaxFiles = 5
+	rotatedFileTimeFormat = "20060102T150405.000"
+)
+
+// recorder writes the fetched records to a JSON-lines file, one record per line, so the consumed traffic
+// can be replayed with a FileBackend. When the file grows over maxBytes, it is renamed with the time of the rotation
+// appended to its name and a new file is started. Only the newest maxFiles rotated files are kept.
+// A nil recorder does not record anything.
+type recorder struct {
+	path     string
+	format   string
+	maxBytes int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// newRecorder returns a recorder for the config, or nil if recording is disabled
+func newRecorder(config QueueConfig) *recorder {
+	if config.RecordPath == "" {
+		return nil
+	}
+	maxBytes := int64(defaultRecordMaxBytes)
+	if config.RecordMaxBytes > 0 {
+		maxBytes = config.RecordMaxBytes
+	}
+	maxFiles := defaultRecordMaxFiles
+	if config.RecordMaxFiles > 0 {
+		maxFiles = config.RecordMaxFiles
+	}
+	return &recorder{path: config.RecordPath, format: config.ConsumerProperties.Format, maxBytes: maxBytes, maxFiles: maxFiles}
+}
+
+// recordedRecord is a line written by the recorder. The format of the consumer is recorded with the value,
+// so the value is decoded the same way on replay.
+type recordedRecord struct {
+	Record
+	Format string `json:"format,omitempty"`
+}
+
+// record appends the records to the file, setting the time they were fetched if they have none.
+// It is safe to be called concurrently.
+func (r *recorder) record(records []Record) error {
+	if r == nil || len(records) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	var lines []byte
+	for _, rec := range records {
+		if rec.Timestamp == 0 {
+			rec.Timestamp = now
+		}
+		line, err := json.Marshal(recordedRecord{Record: rec, Format: r.format})
+		if err != nil {
+			return fmt.Errorf("error marshalling record: %w", err)
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	n, err := r.file.Write(lines)
+	r.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("error writing records: %w", err)
+	}
+	if r.size >= r.maxBytes {
+		return r.rotate()
+	}
+	return nil
+}
+
+func (r *recorder) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening record file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error opening record file: %w", err)
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+// rotatedFiles returns the rotated record files from the oldest to the newest.
+// Only the files named after the record file and a rotation time are returned.
+func (r *recorder) rotatedFiles() ([]string, error) {
+	dir := filepath.Dir(r.path)
+	ext := filepath.Ext(r.path)
+	prefix := strings.TrimSuffix(filepath.Base(r.path), ext) + "-"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var rotated []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) || len(name) != len(prefix)+len(rotatedFileTimeFormat)+len(ext) {
+			continue
+		}
+		if _, err := time.Parse(rotatedFileTimeFormat, name[len(prefix):len(name)-len(ext)]); err != nil {
+			continue
+		}
+		rotated = append(rotated, filepath.Join(dir, name))
+	}
+	sort.Strings(rotated)
+	return rotated, nil
+}
+
+// rotate must be called with the lock held
+func (r *recorder) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("error closing record file: %w", err)
+	}
+	r.file = nil
+
+	ext := filepath.Ext(r.path)
+	base := strings.TrimSuffix(r.path, ext)
+	rotated := base + "-" + time.Now().UTC().Format(rotatedFileTimeFormat) + ext
+	if err := os.Rename(r.path, rotated); err != nil {
+		return fmt.Errorf("error rotating record file: %w", err)
+	}
+
+	old, err := r.rotatedFiles()
+	if err != nil {
+		return fmt.Errorf("error listing rotated record files: %w", err)
+	}
+	for len(old) > r.maxFiles {
+		if err := os.Remove(old[0]); err != nil {
+			return fmt.Errorf("error removing rotated record file: %w", err)
+		}
+		old = old[1:]
+	}
+	return nil
+}
+
+func (r *recorder) close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// Replay hands the messages of the records at path to the handler one by one, in the order they were recorded.
+// The path is read like by a FileBackend, so it can be a file written by the recorder of a Consumer
+// or the directory holding it together with its rotated files.
+// The values are decoded in the format they were recorded in, without resolving Avro schemas.
+func Replay(path string, handler func(m Message), logger *log.UPPLogger) error {
+	if logger == nil {
+		return errors.New("non-nil UPPLogger required")
+	}
+	backend, err := NewFileBackend(path, defaultReplayBatchSize)
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+	decode := func(m Record, logger *log.UPPLogger) (Message, error) {
+		return newValueDecoder(m.format, nil)(m, logger)
+	}
+	for {
+		records, err := backend.Fetch("replay")
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		b, err := decodeRecords(records, decode, logger)
+		if err != nil {
+			return err
+		}
+		for _, m := range b.msgs {
+			handler(m.Message)
+		}
+	}
+}
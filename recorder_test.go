@@ -0,0 +1,130 @@
+package consumer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordedTrafficCanBeReplayed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "records.jsonl")
+	r := newRecorder(QueueConfig{RecordPath: path})
+	records, err := parseRecords(msgsTestByteA)
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.record(records[:1]))
+	assert.NoError(t, r.record(records[1:]))
+	assert.NoError(t, r.close())
+
+	recorded, err := NewFileBackend(path, 0)
+	assert.NoError(t, err)
+	fetched, err := recorded.Fetch("replay")
+	assert.NoError(t, err)
+	assert.Len(t, fetched, 2)
+	for i, rec := range fetched {
+		assert.NotZero(t, rec.Timestamp)
+		rec.Timestamp = 0
+		assert.Equal(t, records[i], rec)
+	}
+
+	var replayed []Message
+	err = Replay(path, func(m Message) { replayed = append(replayed, m) }, log.NewUPPLogger("Test", "FATAL"))
+	assert.NoError(t, err)
+	assert.Equal(t, msgsTest, replayed)
+}
+
+func TestRecordedTrafficIsReplayedInItsFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.jsonl")
+	r := newRecorder(QueueConfig{RecordPath: path, ConsumerProperties: ConsumerProperties{Format: JSONFormat}})
+	records, err := parseFormatRecords([]byte(`[{"topic":"test","value":{"uuid": "c4b96810"},"partition":0,"offset":0},`+
+		`{"topic":"test","value":"FTMSG/1.0\nMessage-Id: 0000\n\n[]","partition":0,"offset":1}]`), JSONFormat)
+	assert.NoError(t, err)
+	assert.NoError(t, r.record(records))
+	assert.NoError(t, r.close())
+
+	var replayed []Message
+	err = Replay(path, func(m Message) { replayed = append(replayed, m) }, log.NewUPPLogger("Test", "FATAL"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Message{{Body: `{"uuid":"c4b96810"}`}, {Headers: map[string]string{"Message-Id": "0000"}, Body: "[]"}}, replayed)
+}
+
+func TestRecorderRotatesFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "records.jsonl")
+	r := newRecorder(QueueConfig{RecordPath: path, RecordMaxBytes: 1, RecordMaxFiles: 2})
+	records, err := parseRecords(msgsTestByteA)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, r.record(records))
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.NoError(t, r.record(records[:1]))
+	assert.NoError(t, r.close())
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "records-*.jsonl"))
+	assert.NoError(t, err)
+	assert.Len(t, rotated, 2, "only the newest rotated files should be kept")
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "the last write should have rotated the file")
+
+	var replayed []Message
+	err = Replay(dir, func(m Message) { replayed = append(replayed, m) }, log.NewUPPLogger("Test", "FATAL"))
+	assert.NoError(t, err)
+	assert.Equal(t, append(msgsTest, msgsTest[0]), replayed)
+}
+
+func TestRotatedFilesWithoutExtensionCanBeReplayed(t *testing.T) {
+	dir := t.TempDir()
+	r := newRecorder(QueueConfig{RecordPath: filepath.Join(dir, "records"), RecordMaxBytes: 1})
+	records, err := parseRecords(msgsTestByteA)
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, r.record(records))
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.NoError(t, r.close())
+
+	var replayed []Message
+	err = Replay(dir, func(m Message) { replayed = append(replayed, m) }, log.NewUPPLogger("Test", "FATAL"))
+	assert.NoError(t, err)
+	assert.Equal(t, append(msgsTest, msgsTest...), replayed)
+}
+
+func TestRecorderDisabled(t *testing.T) {
+	r := newRecorder(QueueConfig{})
+	assert.Nil(t, r)
+	assert.NoError(t, r.record([]Record{{Topic: "test"}}))
+	assert.NoError(t, r.close())
+}
+
+func TestRecorderKeepsUnrelatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "records")
+	for _, name := range []string{"records-backup", "records-20060102T150405.000.old"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+	r := newRecorder(QueueConfig{RecordPath: path, RecordMaxBytes: 1, RecordMaxFiles: 1})
+	records, err := parseRecords(msgsTestByteA)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, r.record(records))
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.NoError(t, r.close())
+
+	for _, name := range []string{"records-backup", "records-20060102T150405.000.old"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.NoError(t, err, "files not written by the recorder should be kept")
+	}
+	rotated, err := r.rotatedFiles()
+	assert.NoError(t, err)
+	assert.Len(t, rotated, 1)
+}
@@ -0,0 +1,227 @@
+package consumer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultTLSReloadInterval = 10 * time.Second
+
+var errTLSTransport = errors.New("the TLS config requires the transport of the client to be an *http.Transport, " +
+	"use a transport built with NewTLSTransport instead")
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig configures the TLS connections to the REST proxy.
+type TLSConfig struct {
+	//PEM encoded client certificate and private key presented to the proxy. Both or none are set.
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	//PEM encoded certificates of the authorities the proxy certificate is verified with. Defaults to the system pool.
+	CAFile string `json:"caFile"`
+	//name the proxy certificate is verified for. Defaults to the host of the address.
+	ServerName         string `json:"serverName"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	//minimum TLS version: 1.0, 1.1, 1.2 or 1.3. Defaults to 1.2.
+	MinVersion string `json:"minVersion"`
+	//period in seconds between the checks of the files for changes. Defaults to 10.
+	ReloadInterval int `json:"reloadInterval"`
+}
+
+// NewTLSTransport returns a transport for the config, based on a clone of base, or of http.DefaultTransport if nil.
+// The certificate files are loaded again when they change on disk, new connections use the new certificates.
+func NewTLSTransport(config TLSConfig, base *http.Transport) (http.RoundTripper, error) {
+	t := newTLSTransport(config, base)
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// tlsTransport builds the transport of the TLS config and rebuilds it when the certificate files change
+type tlsTransport struct {
+	config   TLSConfig
+	base     *http.Transport
+	interval time.Duration
+
+	mu        sync.Mutex
+	checked   time.Time
+	modified  map[string]time.Time
+	transport *http.Transport
+}
+
+func newTLSTransport(config TLSConfig, base *http.Transport) *tlsTransport {
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	interval := defaultTLSReloadInterval
+	if config.ReloadInterval > 0 {
+		interval = time.Duration(config.ReloadInterval) * time.Second
+	}
+	return &tlsTransport{config: config, base: base, interval: interval}
+}
+
+func (t *tlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport, err := t.current()
+	if err != nil {
+		return nil, err
+	}
+	return transport.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of the current transport
+func (t *tlsTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	transport := t.transport
+	t.mu.Unlock()
+	if transport != nil {
+		transport.CloseIdleConnections()
+	}
+}
+
+// current returns the transport, reloading the certificates if the files changed since the last check.
+// If the changed files can't be loaded, the previous transport is kept until they can.
+func (t *tlsTransport) current() (*http.Transport, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.transport == nil || time.Since(t.checked) >= t.interval {
+		t.checked = time.Now()
+		if err := t.reloadChanged(); err != nil && t.transport == nil {
+			return nil, err
+		}
+	}
+	return t.transport, nil
+}
+
+func (t *tlsTransport) reload() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.checked = time.Now()
+	return t.reloadChanged()
+}
+
+func (t *tlsTransport) reloadChanged() error {
+	modified, err := t.modTimes()
+	if err != nil {
+		return err
+	}
+	if t.transport != nil && equalModTimes(modified, t.modified) {
+		return nil
+	}
+
+	tlsConfig, err := t.load()
+	if err != nil {
+		return err
+	}
+	transport := t.base.Clone()
+	transport.TLSClientConfig = tlsConfig
+	if t.transport != nil {
+		// connections in use keep their certificates until they are closed
+		t.transport.CloseIdleConnections()
+	}
+	t.transport, t.modified = transport, modified
+	return nil
+}
+
+func (t *tlsTransport) modTimes() (map[string]time.Time, error) {
+	modified := make(map[string]time.Time)
+	for _, path := range []string{t.config.CertFile, t.config.KeyFile, t.config.CAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading TLS file: %w", err)
+		}
+		modified[path] = info.ModTime()
+	}
+	return modified, nil
+}
+
+func equalModTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, modified := range a {
+		if !modified.Equal(b[path]) {
+			return false
+		}
+	}
+	return true
+}
+
+// load builds the tls.Config from the files
+func (t *tlsTransport) load() (*tls.Config, error) {
+	c := t.config
+	tlsConfig := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if c.MinVersion != "" {
+		version, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version %s", c.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("both the certificate and the key files are required for client authentication")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if c.CAFile != "" {
+		data, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// withTLS returns a copy of the client using the TLS config of the queue, if any.
+// The certificates are loaded once to validate the config. The transport of the client
+// can only be combined with the config when it is an *http.Transport.
+func withTLS(config QueueConfig, client *http.Client) (*http.Client, error) {
+	if config.TLS == nil {
+		return client, nil
+	}
+	tlsClient := &http.Client{}
+	if client != nil {
+		*tlsClient = *client
+	}
+	base, ok := tlsClient.Transport.(*http.Transport)
+	if tlsClient.Transport != nil && !ok {
+		return nil, errTLSTransport
+	}
+	transport, err := NewTLSTransport(*config.TLS, base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS config: %w", err)
+	}
+	tlsClient.Transport = transport
+	return tlsClient, nil
+}
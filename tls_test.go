@@ -0,0 +1,221 @@
+package consumer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA issues certificates signed by its key
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM encoded certificate and key for the given usage
+func (ca *testCA) issue(t *testing.T, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func newMutualTLSServer(t *testing.T, ca *testCA) *httptest.Server {
+	certPEM, keyPEM := ca.issue(t, x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	server.StartTLS()
+	return server
+}
+
+func writeFile(t *testing.T, path string, data []byte, modified time.Time) {
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	require.NoError(t, os.Chtimes(path, modified, modified))
+}
+
+func TestTLSTransportPresentsClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	server := newMutualTLSServer(t, ca)
+	defer server.Close()
+
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.issue(t, x509.ExtKeyUsageClientAuth)
+	config := TLSConfig{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem"), CAFile: filepath.Join(dir, "ca.pem")}
+	writeFile(t, config.CertFile, certPEM, time.Now())
+	writeFile(t, config.KeyFile, keyPEM, time.Now())
+	writeFile(t, config.CAFile, ca.pem, time.Now())
+
+	client, err := withTLS(QueueConfig{TLS: &config}, &http.Client{})
+	require.NoError(t, err)
+	_, err = httpClient{client: client}.DoReq(context.Background(), "GET", server.URL, nil, nil, http.StatusOK)
+	assert.NoError(t, err)
+
+	_, err = httpClient{client: &http.Client{}}.DoReq(context.Background(), "GET", server.URL, nil, nil, http.StatusOK)
+	assert.Error(t, err, "the proxy certificate should not be trusted without the CA")
+}
+
+func TestTLSTransportReloadsRotatedCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	server := newMutualTLSServer(t, ca)
+	defer server.Close()
+
+	dir := t.TempDir()
+	untrustedCert, untrustedKey := newTestCA(t).issue(t, x509.ExtKeyUsageClientAuth)
+	config := TLSConfig{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem"), CAFile: filepath.Join(dir, "ca.pem")}
+	writeFile(t, config.CertFile, untrustedCert, time.Now().Add(-time.Minute))
+	writeFile(t, config.KeyFile, untrustedKey, time.Now().Add(-time.Minute))
+	writeFile(t, config.CAFile, ca.pem, time.Now().Add(-time.Minute))
+
+	transport, err := NewTLSTransport(config, nil)
+	require.NoError(t, err)
+	transport.(*tlsTransport).interval = 0
+	client := httpClient{client: &http.Client{Transport: transport}}
+
+	_, err = client.DoReq(context.Background(), "GET", server.URL, nil, nil, http.StatusOK)
+	assert.Error(t, err, "the proxy should reject a certificate of another CA")
+
+	certPEM, keyPEM := ca.issue(t, x509.ExtKeyUsageClientAuth)
+	writeFile(t, config.CertFile, certPEM, time.Now())
+	writeFile(t, config.KeyFile, keyPEM, time.Now())
+	_, err = client.DoReq(context.Background(), "GET", server.URL, nil, nil, http.StatusOK)
+	assert.NoError(t, err, "the rotated certificate should be presented")
+}
+
+func TestTLSTransportKeepsCertificateWhenReloadFails(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.issue(t, x509.ExtKeyUsageClientAuth)
+	config := TLSConfig{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}
+	writeFile(t, config.CertFile, certPEM, time.Now().Add(-time.Minute))
+	writeFile(t, config.KeyFile, keyPEM, time.Now().Add(-time.Minute))
+
+	transport, err := NewTLSTransport(config, nil)
+	require.NoError(t, err)
+	tt := transport.(*tlsTransport)
+	tt.interval = 0
+	loaded, err := tt.current()
+	require.NoError(t, err)
+
+	writeFile(t, config.CertFile, []byte("partially written"), time.Now())
+	current, err := tt.current()
+	assert.NoError(t, err)
+	assert.Same(t, loaded, current)
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	_, err := NewTLSTransport(TLSConfig{CertFile: "/does/not/exist", KeyFile: "/does/not/exist"}, nil)
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ca.pem")
+	writeFile(t, path, []byte("no certificate"), time.Now())
+	_, err = NewTLSTransport(TLSConfig{CAFile: path}, nil)
+	assert.EqualError(t, err, "no certificates found in CA file "+path)
+
+	_, err = NewTLSTransport(TLSConfig{MinVersion: "2.0"}, nil)
+	assert.EqualError(t, err, "unsupported TLS version 2.0")
+
+	_, err = NewTLSTransport(TLSConfig{CertFile: path}, nil)
+	assert.EqualError(t, err, "both the certificate and the key files are required for client authentication")
+}
+
+func TestWithoutTLSConfigKeepsClient(t *testing.T) {
+	client := &http.Client{}
+	same, err := withTLS(QueueConfig{}, client)
+	require.NoError(t, err)
+	assert.Same(t, client, same)
+
+	base := &http.Transport{MaxIdleConnsPerHost: 7}
+	tlsClient, err := withTLS(QueueConfig{TLS: &TLSConfig{}}, &http.Client{Transport: base, Timeout: time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, tlsClient.Timeout)
+	transport, err := tlsClient.Transport.(*tlsTransport).current()
+	require.NoError(t, err)
+	assert.Equal(t, 7, transport.MaxIdleConnsPerHost)
+}
+
+type instrumentedTransport struct {
+	http.RoundTripper
+}
+
+func TestWithTLSRejectsOtherTransports(t *testing.T) {
+	_, err := withTLS(QueueConfig{TLS: &TLSConfig{}}, &http.Client{Transport: instrumentedTransport{http.DefaultTransport}})
+	assert.Equal(t, errTLSTransport, err)
+}
+
+func TestInvalidTLSConfigIsReportedWithoutRequests(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	config := QueueConfig{Addrs: []string{server.URL}, Group: "group", Topic: "topic", ProxyFailureThreshold: 1, TLS: &TLSConfig{MinVersion: "2.0"}}
+	newQueue := queueCallers(config, &http.Client{}, nil)
+	queue := newQueue(config)
+	_, err := queue.createConsumerInstance()
+	assert.EqualError(t, err, "invalid TLS config: unsupported TLS version 2.0")
+	assert.EqualError(t, queue.checkConnectivity(), "invalid TLS config: unsupported TLS version 2.0")
+	assert.Zero(t, requests)
+}
+
+func TestStreamsShareTLSTransport(t *testing.T) {
+	config := QueueConfig{Addrs: []string{"http://localhost"}, Group: "group", Topic: "topic", TLS: &TLSConfig{}}
+	newQueue := queueCallers(config, &http.Client{}, nil)
+	first := newQueue(config).(*kafkaRESTClient)
+	second := newQueue(config).(*kafkaRESTClient)
+	assert.Same(t, first.caller.(httpClient).client.Transport, second.caller.(httpClient).client.Transport)
+}
@@ -0,0 +1,111 @@
+package consumer
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName      = "github.com/Financial-Times/message-queue-gonsumer"
+	requestIDHeader = "X-Request-Id"
+)
+
+// traceContext propagates the W3C trace context of the messages and of the REST proxy requests
+var traceContext = propagation.TraceContext{}
+
+// newTracer returns the tracer of the configured provider, or of the global provider if none is configured
+func newTracer(config QueueConfig) trace.Tracer {
+	provider := config.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// headerCarrier reads the trace context from the headers of a message, ignoring the case of their names
+type headerCarrier map[string]string
+
+func (h headerCarrier) Get(key string) string {
+	if v, ok := h[key]; ok {
+		return v
+	}
+	for k, v := range h {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h[key] = value
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// messageAttributes returns the attributes of the span of a message
+func messageAttributes(m Message) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("messaging.system", "kafka")}
+	if requestID := headerCarrier(m.Headers).Get(requestIDHeader); requestID != "" {
+		attrs = append(attrs, attribute.String("messaging.message.conversation_id", requestID))
+	}
+	return attrs
+}
+
+// startHandleSpan starts the span of handling a message, as a child of the span in the trace headers of the message
+func startHandleSpan(tracer trace.Tracer, m Message) (context.Context, trace.Span) {
+	ctx := traceContext.Extract(context.Background(), headerCarrier(m.Headers))
+	return tracer.Start(ctx, "handle", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(messageAttributes(m)...))
+}
+
+// startBatchHandleSpan starts the span of handling a batch of messages, linked to the spans in the trace headers of the messages
+func startBatchHandleSpan(tracer trace.Tracer, msgs []Message) (context.Context, trace.Span) {
+	links := make([]trace.Link, 0, len(msgs))
+	for _, m := range msgs {
+		sc := trace.SpanContextFromContext(traceContext.Extract(context.Background(), headerCarrier(m.Headers)))
+		if sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc, Attributes: messageAttributes(m)})
+		}
+	}
+	return tracer.Start(context.Background(), "handle", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithLinks(links...),
+		trace.WithAttributes(attribute.String("messaging.system", "kafka"), attribute.Int("messaging.batch.message_count", len(msgs))))
+}
+
+// tracedHandler adapts a handler receiving a context to a handler starting the span of each message
+func tracedHandler(tracer trace.Tracer, handler func(ctx context.Context, m Message) error) func(m Message) error {
+	return func(m Message) (err error) {
+		ctx, span := startHandleSpan(tracer, m)
+		defer func() { endSpan(span, err) }()
+		return handler(ctx, m)
+	}
+}
+
+// tracedBatchHandler adapts a batch handler receiving a context to a handler starting the span of each batch
+func tracedBatchHandler(tracer trace.Tracer, handler func(ctx context.Context, m []Message) error) func(m []Message) error {
+	return func(msgs []Message) (err error) {
+		ctx, span := startBatchHandleSpan(tracer, msgs)
+		defer func() { endSpan(span, err) }()
+		return handler(ctx, msgs)
+	}
+}
+
+// endSpan records the error, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
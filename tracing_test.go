@@ -0,0 +1,124 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func newTestTracerProvider() (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	return sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)), recorder
+}
+
+func spanNames(spans []sdktrace.ReadOnlySpan) []string {
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.Name())
+	}
+	return names
+}
+
+func TestTracedHandlerContinuesMessageTrace(t *testing.T) {
+	provider, recorder := newTestTracerProvider()
+	m := Message{Headers: map[string]string{"Traceparent": testTraceparent, "X-Request-Id": "tid_test"}}
+
+	var handled trace.SpanContext
+	handler := tracedHandler(newTracer(QueueConfig{TracerProvider: provider}), func(ctx context.Context, m Message) error {
+		handled = trace.SpanContextFromContext(ctx)
+		return errors.New("handler failure")
+	})
+	err := handler(m)
+
+	assert.EqualError(t, err, "handler failure")
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		span := spans[0]
+		assert.Equal(t, "handle", span.Name())
+		assert.Equal(t, handled, span.SpanContext())
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+		assert.Equal(t, codes.Error, span.Status().Code)
+		assert.Contains(t, span.Attributes(), messageAttributes(m)[1])
+	}
+}
+
+func TestTracedBatchHandlerLinksMessageTraces(t *testing.T) {
+	provider, recorder := newTestTracerProvider()
+	msgs := []Message{
+		{Headers: map[string]string{"traceparent": testTraceparent}},
+		{Headers: map[string]string{"X-Request-Id": "tid_untraced"}},
+	}
+
+	handler := tracedBatchHandler(newTracer(QueueConfig{TracerProvider: provider}), func(ctx context.Context, m []Message) error {
+		assert.True(t, trace.SpanContextFromContext(ctx).IsValid())
+		return nil
+	})
+	assert.NoError(t, handler(msgs))
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		assert.Len(t, spans[0].Links(), 1)
+		assert.Equal(t, "00f067aa0ba902b7", spans[0].Links()[0].SpanContext.SpanID().String())
+	}
+}
+
+func TestConsumerInstanceTracesFetchParseAndCommit(t *testing.T) {
+	provider, recorder := newTestTracerProvider()
+	consumer := &consumerInstance{
+		config: QueueConfig{}, queue: defaultTestQueueCaller{}, consumer: consInstTest,
+		processor: splitProcessor(func(m Message) {}), logger: log.NewUPPLogger("Test", "FATAL"),
+		tracer: newTracer(QueueConfig{TracerProvider: provider}),
+	}
+
+	_, err := consumer.consume()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"parse", "fetch", "commit"}, spanNames(recorder.Ended()))
+}
+
+func TestHTTPClientPropagatesTraceContext(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	provider, recorder := newTestTracerProvider()
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "fetch")
+	_, err := httpClient{client: server.Client()}.DoReq(ctx, "GET", server.URL, nil, nil, http.StatusOK)
+	parent.End()
+
+	assert.NoError(t, err)
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 2) {
+		request := spans[0]
+		assert.Equal(t, "HTTP GET", request.Name())
+		assert.Equal(t, parent.SpanContext().SpanID(), request.Parent().SpanID())
+		assert.Contains(t, traceparent, request.SpanContext().SpanID().String())
+	}
+}
+
+func TestHTTPClientWithoutSpanIsNotTraced(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("traceparent"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, err := httpClient{client: server.Client()}.DoReq(context.Background(), "GET", server.URL, nil, nil, http.StatusOK)
+
+	assert.NoError(t, err)
+}
@@ -0,0 +1,76 @@
+package consumer
+
+import "sync"
+
+const (
+	defaultNoOfProcessors   = 100
+	defaultWorkerQueueDepth = 128
+)
+
+// workerPool is a fixed set of goroutines shared by all the consumer instances of a Consumer
+// for processing messages concurrently. It is started and stopped together with the Consumer.
+type workerPool struct {
+	size       int
+	queueDepth int
+	tasks      chan func()
+	workers    sync.WaitGroup
+}
+
+// newWorkerPool returns a workerPool sized according to the config, or nil if messages are not processed concurrently
+func newWorkerPool(config QueueConfig, streamCount int) *workerPool {
+	if !config.ConcurrentProcessing {
+		return nil
+	}
+	size := config.MaxWorkers
+	if size <= 0 {
+		processors := defaultNoOfProcessors
+		if config.NoOfProcessors > 0 {
+			processors = config.NoOfProcessors
+		}
+		size = processors * streamCount
+	}
+	queueDepth := defaultWorkerQueueDepth
+	if config.WorkerQueueDepth > 0 {
+		queueDepth = config.WorkerQueueDepth
+	}
+	return &workerPool{size: size, queueDepth: queueDepth}
+}
+
+func (p *workerPool) start() {
+	if p == nil {
+		return
+	}
+	p.tasks = make(chan func(), p.queueDepth)
+	p.workers.Add(p.size)
+	for i := 0; i < p.size; i++ {
+		go func() {
+			defer p.workers.Done()
+			for task := range p.tasks {
+				task()
+			}
+		}()
+	}
+}
+
+func (p *workerPool) stop() {
+	if p == nil {
+		return
+	}
+	close(p.tasks)
+	p.workers.Wait()
+}
+
+// process hands the messages to the workers one by one and waits until all of them are consumed.
+// It blocks while the queue of the pool is full.
+func (p *workerPool) process(msgs []delivery, consume func(m delivery)) {
+	var wg sync.WaitGroup
+	wg.Add(len(msgs))
+	for _, msg := range msgs {
+		m := msg
+		p.tasks <- func() {
+			defer wg.Done()
+			consume(m)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,86 @@
+package consumer
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	log "github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPoolLimitsConcurrencyAcrossStreams(t *testing.T) {
+	pool := newWorkerPool(QueueConfig{ConcurrentProcessing: true, MaxWorkers: 3, WorkerQueueDepth: 1}, 2)
+	pool.start()
+	defer pool.stop()
+
+	var running, maxRunning atomic.Int32
+	started := make(chan struct{}, 6)
+	release := make(chan struct{})
+	consume := func(m delivery) {
+		n := running.Add(1)
+		for {
+			max := maxRunning.Load()
+			if n <= max || maxRunning.CompareAndSwap(max, n) {
+				break
+			}
+		}
+		started <- struct{}{}
+		<-release
+		running.Add(-1)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.process([]delivery{{Message: Message{Body: "1"}}, {Message: Message{Body: "2"}}, {Message: Message{Body: "3"}}}, consume)
+		}()
+	}
+	// all workers are busy, every released message lets exactly one waiting message start
+	for i := 0; i < 3; i++ {
+		<-started
+	}
+	for i := 0; i < 3; i++ {
+		release <- struct{}{}
+		<-started
+	}
+	for i := 0; i < 3; i++ {
+		release <- struct{}{}
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(3), maxRunning.Load())
+}
+
+func TestWorkerPoolDefaults(t *testing.T) {
+	assert.Nil(t, newWorkerPool(QueueConfig{}, 4))
+
+	pool := newWorkerPool(QueueConfig{ConcurrentProcessing: true}, 4)
+	assert.Equal(t, 400, pool.size)
+	assert.Equal(t, 128, pool.queueDepth)
+
+	pool = newWorkerPool(QueueConfig{ConcurrentProcessing: true, NoOfProcessors: 5}, 4)
+	assert.Equal(t, 20, pool.size)
+}
+
+func TestConcurrentConsumeUsesWorkerPool(t *testing.T) {
+	pool := newWorkerPool(QueueConfig{ConcurrentProcessing: true, MaxWorkers: 2}, 1)
+	pool.start()
+	defer pool.stop()
+
+	var mu sync.Mutex
+	var handled []Message
+	c := &consumerInstance{config: QueueConfig{ConcurrentProcessing: true}, queue: defaultTestQueueCaller{}, consumer: consInstTest, pool: pool,
+		processor: splitProcessor(func(m Message) {
+			mu.Lock()
+			handled = append(handled, m)
+			mu.Unlock()
+		}), logger: log.NewUPPLogger("Test", "FATAL")}
+
+	msgs, err := c.consume()
+	assert.NoError(t, err)
+	assert.Equal(t, msgsTest, messagesOf(msgs))
+	assert.Len(t, handled, len(msgsTest))
+}